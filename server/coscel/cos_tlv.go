@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 	"unicode/utf8"
 
@@ -48,8 +49,132 @@ const (
 	MemoryMonitorType
 	GpuCCModeType
 	GPUDeviceAttestationBindingType
+	LauncherVersionType
+	LaunchFailedType
+	PrivilegedType
+	CapabilityType
+	TeeTechnologyType
+	DNSServerType
+	DNSSearchDomainType
+	MountType
+	PlatformType
+	SealingPolicyType
+	LaunchPolicyType
+	NonceType
+	RunAsUserType
+	ConfigHashType
+	ImageCreatedType
+	ProbeConfigType
+	GrantedResourceType
+	TerminationGracePeriodType
+	RestartCountType
+	KernelCmdlineType
+	SignerType
+	LoggingConfigType
+	VulnerabilityScanType
+	PlatformMismatchType
+	InstanceMetadataType
+	PullCredentialSourceType
+	ReadOnlyRootfsType
+	ExperimentalFeatureType
+	SeccompProfileType
+	SbomReferenceType
+	NetworkModeType
+	AcceleratorType
+	TokenAudienceType
+	ProvenanceReferenceType
+	LifecycleHookType
+	LayerDigestType
+	UlimitType
+	SourceRevisionType
+	NamespaceSharingType
 )
 
+// eventTypeNames maps each known COS content type to its name.
+var eventTypeNames = map[ContentType]string{
+	ImageRefType:                    "ImageRef",
+	ImageDigestType:                 "ImageDigest",
+	RestartPolicyType:               "RestartPolicy",
+	ImageIDType:                     "ImageID",
+	ArgType:                         "Arg",
+	EnvVarType:                      "EnvVar",
+	OverrideArgType:                 "OverrideArg",
+	OverrideEnvType:                 "OverrideEnv",
+	LaunchSeparatorType:             "LaunchSeparator",
+	MemoryMonitorType:               "MemoryMonitor",
+	GpuCCModeType:                   "GpuCCMode",
+	GPUDeviceAttestationBindingType: "GPUDeviceAttestationBinding",
+	LauncherVersionType:             "LauncherVersion",
+	LaunchFailedType:                "LaunchFailed",
+	PrivilegedType:                  "Privileged",
+	CapabilityType:                  "Capability",
+	TeeTechnologyType:               "TeeTechnology",
+	DNSServerType:                   "DNSServer",
+	DNSSearchDomainType:             "DNSSearchDomain",
+	MountType:                       "Mount",
+	PlatformType:                    "Platform",
+	SealingPolicyType:               "SealingPolicy",
+	LaunchPolicyType:                "LaunchPolicy",
+	NonceType:                       "Nonce",
+	RunAsUserType:                   "RunAsUser",
+	ConfigHashType:                  "ConfigHash",
+	ImageCreatedType:                "ImageCreated",
+	ProbeConfigType:                 "ProbeConfig",
+	GrantedResourceType:             "GrantedResource",
+	TerminationGracePeriodType:      "TerminationGracePeriod",
+	RestartCountType:                "RestartCount",
+	KernelCmdlineType:               "KernelCmdline",
+	SignerType:                      "Signer",
+	LoggingConfigType:               "LoggingConfig",
+	VulnerabilityScanType:           "VulnerabilityScan",
+	PlatformMismatchType:            "PlatformMismatch",
+	InstanceMetadataType:            "InstanceMetadata",
+	PullCredentialSourceType:        "PullCredentialSource",
+	ReadOnlyRootfsType:              "ReadOnlyRootfs",
+	ExperimentalFeatureType:         "ExperimentalFeature",
+	SeccompProfileType:              "SeccompProfile",
+	SbomReferenceType:               "SbomReference",
+	NetworkModeType:                 "NetworkMode",
+	AcceleratorType:                 "Accelerator",
+	TokenAudienceType:               "TokenAudience",
+	ProvenanceReferenceType:         "ProvenanceReference",
+	LifecycleHookType:               "LifecycleHook",
+	LayerDigestType:                 "LayerDigest",
+	UlimitType:                      "Ulimit",
+	SourceRevisionType:              "SourceRevision",
+	NamespaceSharingType:            "NamespaceSharing",
+}
+
+// EventTypes returns all known COS content types in ascending order.
+func EventTypes() []ContentType {
+	types := make([]ContentType, 0, len(eventTypeNames))
+	for t := range eventTypeNames {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// EventTypeName returns the name of the COS content type, or a placeholder
+// containing its numeric value if the type is unknown.
+func EventTypeName(t ContentType) string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ContentType(%d)", uint8(t))
+}
+
+// EventTypeByName returns the COS content type with the given name, as
+// returned by EventTypeName, and whether the name is known.
+func EventTypeByName(name string) (ContentType, bool) {
+	for t, n := range eventTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
 // COSTLV is a specific event type created for the COS (Google Container-Optimized OS),
 // used as a CEL content.
 type COSTLV struct {
@@ -59,7 +184,7 @@ type COSTLV struct {
 
 // TLV returns the TLV representation of the COS TLV.
 func (c COSTLV) TLV() (cel.TLV, error) {
-	data, err := cel.TLV{uint8(c.EventType), c.EventContent}.MarshalBinary()
+	data, err := cel.TLV{Type: uint8(c.EventType), Value: c.EventContent}.MarshalBinary()
 	if err != nil {
 		return cel.TLV{}, err
 	}
@@ -109,35 +234,45 @@ func IsCOSTLV(t cel.TLV) bool {
 	return t.Type == CELRType
 }
 
+var envVarNameRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
 // FormatEnvVar takes in an environment variable name and its value, run some checks. Concats
 // the name and value by '=' and returns it if valid; returns an error if the name or value
 // is invalid.
 func FormatEnvVar(name string, value string) (string, error) {
+	if err := validateEnvVar(name, value); err != nil {
+		return "", err
+	}
+	return name + "=" + value, nil
+}
+
+// validateEnvVar checks that name and value are valid UTF-8 and that name is a
+// valid env var name.
+func validateEnvVar(name string, value string) error {
 	if !utf8.ValidString(name) {
-		return "", fmt.Errorf("malformed env name, contains non-utf8 character: [%s]", name)
+		return fmt.Errorf("malformed env name, contains non-utf8 character: [%s]", name)
 	}
 	if !utf8.ValidString(value) {
-		return "", fmt.Errorf("malformed env value, contains non-utf8 character: [%s]", value)
+		return fmt.Errorf("malformed env value, contains non-utf8 character: [%s]", value)
 	}
-	var envVarNameRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 	if !envVarNameRegexp.MatchString(name) {
-		return "", fmt.Errorf("malformed env name [%s], env name must start with an alpha character or '_', followed by a string of alphanumeric characters or '_' (%s)", name, envVarNameRegexp)
+		return fmt.Errorf("malformed env name [%s], env name must start with an alpha character or '_', followed by a string of alphanumeric characters or '_' (%s)", name, envVarNameRegexp)
 	}
-	return name + "=" + value, nil
+	return nil
 }
 
 // ParseEnvVar takes in environment variable as a string (foo=bar), parses it and returns its name
 // and value, or an error if it fails the validation check.
 func ParseEnvVar(envvar string) (string, string, error) {
-	// switch to strings.Cut when upgrading to go 1.18
-	e := strings.SplitN(string(envvar), "=", 2)
-	if len(e) < 2 {
+	i := strings.IndexByte(envvar, '=')
+	if i < 0 {
 		return "", "", fmt.Errorf("malformed env var, doesn't contain '=': [%s]", envvar)
 	}
+	name, value := envvar[:i], envvar[i+1:]
 
-	if _, err := FormatEnvVar(e[0], e[1]); err != nil {
+	if err := validateEnvVar(name, value); err != nil {
 		return "", "", err
 	}
 
-	return e[0], e[1], nil
+	return name, value, nil
 }
@@ -0,0 +1,26 @@
+package extract
+
+import (
+	"errors"
+
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// RegisterTypeFromAttestation returns the register type the COS events of
+// the attestation's canonical event log are measured into. With TPM quotes the
+// events are measured into a PCR, regardless of any TEE attestation. Without
+// TPM quotes, a TDX attestation means the events are measured into a CCMR
+// (RTMR). No other attestation carries COS measurements.
+func RegisterTypeFromAttestation(att *pb.Attestation) (uint8, error) {
+	if len(att.GetQuotes()) > 0 {
+		return uint8(cel.PCRType), nil
+	}
+	if att.GetTdxAttestation() != nil {
+		return uint8(cel.CCMRType), nil
+	}
+	if att.GetSevSnpAttestation() != nil {
+		return 0, errors.New("SEV-SNP attestation without TPM quotes has no register for COS events")
+	}
+	return 0, errors.New("attestation has neither TPM quotes nor a TDX attestation")
+}
@@ -0,0 +1,73 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/google/go-tdx-guest/proto/tdx"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+	tpmpb "github.com/google/go-tpm-tools/proto/tpm"
+)
+
+func TestRegisterTypeFromAttestation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		att     *pb.Attestation
+		want    uint8
+		wantErr bool
+	}{
+		{
+			name: "TPM",
+			att:  &pb.Attestation{Quotes: []*tpmpb.Quote{{}}},
+			want: uint8(cel.PCRType),
+		},
+		{
+			name: "TDX",
+			att:  &pb.Attestation{TeeAttestation: &pb.Attestation_TdxAttestation{TdxAttestation: &tdx.QuoteV4{}}},
+			want: uint8(cel.CCMRType),
+		},
+		{
+			name: "TPM with TDX",
+			att: &pb.Attestation{
+				Quotes:         []*tpmpb.Quote{{}},
+				TeeAttestation: &pb.Attestation_TdxAttestation{TdxAttestation: &tdx.QuoteV4{}},
+			},
+			want: uint8(cel.PCRType),
+		},
+		{
+			name: "TPM with SEV-SNP",
+			att: &pb.Attestation{
+				Quotes:         []*tpmpb.Quote{{}},
+				TeeAttestation: &pb.Attestation_SevSnpAttestation{SevSnpAttestation: &sevsnp.Attestation{}},
+			},
+			want: uint8(cel.PCRType),
+		},
+		{
+			name:    "SEV-SNP only",
+			att:     &pb.Attestation{TeeAttestation: &pb.Attestation_SevSnpAttestation{SevSnpAttestation: &sevsnp.Attestation{}}},
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			att:     &pb.Attestation{},
+			wantErr: true,
+		},
+		{
+			name:    "nil",
+			att:     nil,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := RegisterTypeFromAttestation(tc.att)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("RegisterTypeFromAttestation() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("RegisterTypeFromAttestation() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
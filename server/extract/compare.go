@@ -0,0 +1,191 @@
+package extract
+
+import (
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// CanonicalEqual reports whether a and b describe the same COS state.
+// Unlike proto.Equal, a nil state or sub-message is equal to an empty one, so
+// states returned by VerifiedCOSState, which always allocates the container,
+// health monitoring and GPU device state, compare equal to states built
+// elsewhere that leave them unset. Nil and empty maps and lists are equal,
+// and map ordering is ignored.
+func CanonicalEqual(a, b *pb.AttestedCosState) bool {
+	return proto.Equal(canonicalCOSState(a), canonicalCOSState(b))
+}
+
+// canonicalCOSState returns a copy of state with all nil sub-messages
+// replaced by empty ones.
+func canonicalCOSState(state *pb.AttestedCosState) *pb.AttestedCosState {
+	canonical := &pb.AttestedCosState{}
+	if state != nil {
+		canonical = proto.Clone(state).(*pb.AttestedCosState)
+	}
+	if canonical.Container == nil {
+		canonical.Container = &pb.ContainerState{}
+	}
+	if canonical.CosVersion == nil {
+		canonical.CosVersion = &pb.SemanticVersion{}
+	}
+	if canonical.LauncherVersion == nil {
+		canonical.LauncherVersion = &pb.SemanticVersion{}
+	}
+	if canonical.HealthMonitoring == nil {
+		canonical.HealthMonitoring = &pb.HealthMonitoringState{}
+	}
+	if canonical.GpuDeviceState == nil {
+		canonical.GpuDeviceState = &pb.GpuDeviceState{}
+	}
+	return canonical
+}
+
+// DeltaFromBaseline returns a state holding only the fields of actual which
+// differ from baseline, e.g. the overrides and extra env vars an operator
+// applied to a known launch template. Sub-messages without differences are
+// left nil, so identical states give an empty state. Args and overridden args
+// are compared as whole lists, env vars and overridden env vars per entry.
+// Values removed from baseline and changes to a zero value, such as the
+// Always restart policy, cannot be represented and are not reported; use
+// CanonicalEqual to detect any difference.
+func DeltaFromBaseline(actual, baseline *pb.AttestedCosState) *pb.AttestedCosState {
+	actual, baseline = canonicalCOSState(actual), canonicalCOSState(baseline)
+	delta := &pb.AttestedCosState{}
+
+	if container := containerDelta(actual.Container, baseline.Container); !proto.Equal(container, &pb.ContainerState{}) {
+		delta.Container = container
+	}
+	if !proto.Equal(actual.CosVersion, baseline.CosVersion) {
+		delta.CosVersion = actual.CosVersion
+	}
+	if !proto.Equal(actual.LauncherVersion, baseline.LauncherVersion) {
+		delta.LauncherVersion = actual.LauncherVersion
+	}
+	if !proto.Equal(actual.HealthMonitoring, baseline.HealthMonitoring) {
+		delta.HealthMonitoring = actual.HealthMonitoring
+	}
+	if !proto.Equal(actual.GpuDeviceState, baseline.GpuDeviceState) {
+		delta.GpuDeviceState = actual.GpuDeviceState
+	}
+	return delta
+}
+
+// containerDelta returns the fields of actual which differ from baseline.
+func containerDelta(actual, baseline *pb.ContainerState) *pb.ContainerState {
+	delta := &pb.ContainerState{}
+	if actual.ImageReference != baseline.ImageReference {
+		delta.ImageReference = actual.ImageReference
+	}
+	if actual.ImageDigest != baseline.ImageDigest {
+		delta.ImageDigest = actual.ImageDigest
+	}
+	if actual.RestartPolicy != baseline.RestartPolicy {
+		delta.RestartPolicy = actual.RestartPolicy
+	}
+	if actual.ImageId != baseline.ImageId {
+		delta.ImageId = actual.ImageId
+	}
+	if !slices.Equal(actual.Args, baseline.Args) {
+		delta.Args = actual.Args
+	}
+	if !slices.Equal(actual.OverriddenArgs, baseline.OverriddenArgs) {
+		delta.OverriddenArgs = actual.OverriddenArgs
+	}
+	delta.EnvVars = envVarsDelta(actual.EnvVars, baseline.EnvVars)
+	delta.OverriddenEnvVars = envVarsDelta(actual.OverriddenEnvVars, baseline.OverriddenEnvVars)
+	return delta
+}
+
+// envVarsDelta returns the entries of actual which are missing from or
+// differ in baseline, or nil if there are none.
+func envVarsDelta(actual, baseline map[string]string) map[string]string {
+	var delta map[string]string
+	for name, value := range actual {
+		if baselineValue, ok := baseline[name]; ok && baselineValue == value {
+			continue
+		}
+		if delta == nil {
+			delta = make(map[string]string)
+		}
+		delta[name] = value
+	}
+	return delta
+}
+
+// SortedArgs returns a sorted copy of args, such as Container.Args or
+// Container.OverriddenArgs, leaving args unchanged. The state keeps args in
+// log order, which is the order they are passed to the container, and that
+// order matters whenever an arg's meaning depends on its position, e.g. the
+// executable, subcommands and flag values passed as separate args. Compare
+// sorted copies only when the args are independent flags, such as
+// "--flag=value" args, whose order the workload ignores.
+func SortedArgs(args []string) []string {
+	sorted := slices.Clone(args)
+	slices.Sort(sorted)
+	return sorted
+}
+
+// NormalizeArgs returns a copy of args with shell quoting removed from each
+// arg, so args a policy writes quoted, e.g. --name="my app", equal the
+// unquoted args measured in the log, e.g. --name=my app. Each arg stays one
+// arg; whitespace is never split on. Per arg, as in a POSIX shell:
+//   - characters between single quotes are kept literally;
+//   - between double quotes, a backslash escapes a following ", \, $ or `
+//     and is kept literally before any other character;
+//   - outside quotes, a backslash escapes the following character.
+//
+// An arg with an unterminated quote or a trailing backslash is kept
+// unchanged. Use EqualArgsIgnoringQuotes to compare.
+func NormalizeArgs(args []string) []string {
+	normalized := make([]string, len(args))
+	for i, arg := range args {
+		normalized[i] = unquoteArg(arg)
+	}
+	return normalized
+}
+
+// EqualArgsIgnoringQuotes reports whether a and b are equal after
+// NormalizeArgs.
+func EqualArgsIgnoringQuotes(a, b []string) bool {
+	return slices.Equal(NormalizeArgs(a), NormalizeArgs(b))
+}
+
+// unquoteArg removes shell quoting from arg as described by NormalizeArgs.
+func unquoteArg(arg string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+				continue
+			}
+		case c == '\\':
+			if i+1 == len(arg) {
+				return arg
+			}
+			if quote == 0 || strings.IndexByte("\"\\$`", arg[i+1]) >= 0 {
+				i++
+				c = arg[i]
+			}
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+				continue
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			continue
+		}
+		b.WriteByte(c)
+	}
+	if quote != 0 {
+		return arg
+	}
+	return b.String()
+}
@@ -0,0 +1,260 @@
+package extract
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+	"google.golang.org/protobuf/proto"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestCanonicalEqual(t *testing.T) {
+	enabled := true
+	disabled := false
+	testCases := []struct {
+		name string
+		a    *pb.AttestedCosState
+		b    *pb.AttestedCosState
+		want bool
+	}{
+		{"both nil", nil, nil, true},
+		{"nil and empty", nil, &pb.AttestedCosState{}, true},
+		{
+			name: "nil and empty sub-messages",
+			a:    &pb.AttestedCosState{},
+			b: &pb.AttestedCosState{
+				Container:        &pb.ContainerState{},
+				HealthMonitoring: &pb.HealthMonitoringState{},
+				GpuDeviceState:   &pb.GpuDeviceState{},
+			},
+			want: true,
+		},
+		{
+			name: "nil and empty collections",
+			a:    &pb.AttestedCosState{Container: &pb.ContainerState{ImageReference: "image"}},
+			b: &pb.AttestedCosState{Container: &pb.ContainerState{
+				ImageReference:    "image",
+				Args:              []string{},
+				EnvVars:           map[string]string{},
+				OverriddenEnvVars: map[string]string{},
+			}},
+			want: true,
+		},
+		{
+			name: "same env vars",
+			a:    &pb.AttestedCosState{Container: &pb.ContainerState{EnvVars: map[string]string{"foo": "bar", "bar": "baz"}}},
+			b:    &pb.AttestedCosState{Container: &pb.ContainerState{EnvVars: map[string]string{"bar": "baz", "foo": "bar"}}},
+			want: true,
+		},
+		{
+			name: "different env vars",
+			a:    &pb.AttestedCosState{Container: &pb.ContainerState{EnvVars: map[string]string{"foo": "bar"}}},
+			b:    &pb.AttestedCosState{Container: &pb.ContainerState{EnvVars: map[string]string{"foo": "baz"}}},
+		},
+		{
+			name: "empty env var and no env var",
+			a:    &pb.AttestedCosState{Container: &pb.ContainerState{EnvVars: map[string]string{"foo": ""}}},
+			b:    &pb.AttestedCosState{},
+		},
+		{
+			name: "memory monitoring disabled and unset",
+			a:    &pb.AttestedCosState{HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &disabled}},
+			b:    &pb.AttestedCosState{},
+		},
+		{
+			name: "memory monitoring enabled",
+			a:    &pb.AttestedCosState{HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &enabled}},
+			b:    &pb.AttestedCosState{HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &enabled}},
+			want: true,
+		},
+		{
+			name: "different args order",
+			a:    &pb.AttestedCosState{Container: &pb.ContainerState{Args: []string{"--x", "--y"}}},
+			b:    &pb.AttestedCosState{Container: &pb.ContainerState{Args: []string{"--y", "--x"}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CanonicalEqual(tc.a, tc.b); got != tc.want {
+				t.Errorf("CanonicalEqual() = %v, want %v", got, tc.want)
+			}
+			if got := CanonicalEqual(tc.b, tc.a); got != tc.want {
+				t.Errorf("CanonicalEqual() with swapped arguments = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalEqualExtractedState(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+	})
+	extracted, err := VerifiedCOSState(eventLog, uint8(cel.CCMRType), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := &pb.AttestedCosState{Container: &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest"}}
+	if proto.Equal(extracted, built) {
+		t.Fatalf("proto.Equal() = true, want false for the nil vs empty sub-message difference")
+	}
+	if !CanonicalEqual(extracted, built) {
+		t.Errorf("CanonicalEqual() = false, want true")
+	}
+}
+
+func TestDeltaFromBaseline(t *testing.T) {
+	enabled := true
+	baseline := &pb.AttestedCosState{
+		Container: &pb.ContainerState{
+			ImageReference: "docker.io/a:latest",
+			ImageDigest:    testImageDigest,
+			RestartPolicy:  pb.RestartPolicy_Never,
+			Args:           []string{"/bin/server", "--port=80"},
+			EnvVars:        map[string]string{"ENV": "prod", "REGION": "us"},
+		},
+		LauncherVersion: &pb.SemanticVersion{Major: 1, Minor: 2},
+	}
+	testCases := []struct {
+		name   string
+		actual *pb.AttestedCosState
+		want   *pb.AttestedCosState
+	}{
+		{
+			name:   "identical",
+			actual: proto.Clone(baseline).(*pb.AttestedCosState),
+			want:   &pb.AttestedCosState{},
+		},
+		{
+			name: "identical with empty sub-messages",
+			actual: func() *pb.AttestedCosState {
+				state := proto.Clone(baseline).(*pb.AttestedCosState)
+				state.Container.OverriddenEnvVars = map[string]string{}
+				state.HealthMonitoring = &pb.HealthMonitoringState{}
+				state.GpuDeviceState = &pb.GpuDeviceState{}
+				return state
+			}(),
+			want: &pb.AttestedCosState{},
+		},
+		{
+			name: "overrides and extra env",
+			actual: func() *pb.AttestedCosState {
+				state := proto.Clone(baseline).(*pb.AttestedCosState)
+				state.Container.OverriddenArgs = []string{"--port=8080"}
+				state.Container.OverriddenEnvVars = map[string]string{"ENV": "staging"}
+				state.Container.EnvVars["DEBUG"] = "1"
+				return state
+			}(),
+			want: &pb.AttestedCosState{
+				Container: &pb.ContainerState{
+					OverriddenArgs:    []string{"--port=8080"},
+					EnvVars:           map[string]string{"DEBUG": "1"},
+					OverriddenEnvVars: map[string]string{"ENV": "staging"},
+				},
+			},
+		},
+		{
+			name: "changed image, args, versions and monitoring",
+			actual: func() *pb.AttestedCosState {
+				state := proto.Clone(baseline).(*pb.AttestedCosState)
+				state.Container.ImageReference = "docker.io/b:latest"
+				state.Container.RestartPolicy = pb.RestartPolicy_OnFailure
+				state.Container.Args = []string{"/bin/server"}
+				state.Container.EnvVars["REGION"] = "eu"
+				state.LauncherVersion = &pb.SemanticVersion{Major: 1, Minor: 3}
+				state.HealthMonitoring = &pb.HealthMonitoringState{MemoryEnabled: &enabled}
+				return state
+			}(),
+			want: &pb.AttestedCosState{
+				Container: &pb.ContainerState{
+					ImageReference: "docker.io/b:latest",
+					RestartPolicy:  pb.RestartPolicy_OnFailure,
+					Args:           []string{"/bin/server"},
+					EnvVars:        map[string]string{"REGION": "eu"},
+				},
+				LauncherVersion:  &pb.SemanticVersion{Major: 1, Minor: 3},
+				HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &enabled},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DeltaFromBaseline(tc.actual, baseline); !proto.Equal(got, tc.want) {
+				t.Errorf("DeltaFromBaseline() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortedArgs(t *testing.T) {
+	testCases := []struct {
+		name             string
+		a                []string
+		b                []string
+		wantOrderedEqual bool
+		wantSortedEqual  bool
+	}{
+		{"same order", []string{"--a=1", "--b=2"}, []string{"--a=1", "--b=2"}, true, true},
+		{"different order", []string{"--b=2", "--a=1"}, []string{"--a=1", "--b=2"}, false, true},
+		{"different args", []string{"--a=1", "--b=2"}, []string{"--a=1", "--b=3"}, false, false},
+		{"duplicate args", []string{"-v", "-v", "-q"}, []string{"-v", "-q", "-q"}, false, false},
+		{"nil and empty", nil, []string{}, true, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := slices.Clone(tc.a)
+			if got := slices.Equal(tc.a, tc.b); got != tc.wantOrderedEqual {
+				t.Errorf("slices.Equal(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.wantOrderedEqual)
+			}
+			if got := slices.Equal(SortedArgs(tc.a), SortedArgs(tc.b)); got != tc.wantSortedEqual {
+				t.Errorf("slices.Equal(SortedArgs(%q), SortedArgs(%q)) = %v, want %v", tc.a, tc.b, got, tc.wantSortedEqual)
+			}
+			if !slices.Equal(tc.a, original) {
+				t.Errorf("SortedArgs() modified its input to %q, want %q", tc.a, original)
+			}
+		})
+	}
+}
+
+func TestNormalizeArgs(t *testing.T) {
+	testCases := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"unquoted", "--name=app", "--name=app"},
+		{"double quoted", `--name="my app"`, "--name=my app"},
+		{"single quoted", `--name='my app'`, "--name=my app"},
+		{"fully quoted", `"--name=my app"`, "--name=my app"},
+		{"escaped space", `--name=my\ app`, "--name=my app"},
+		{"single quotes keep backslash", `'a\b'`, `a\b`},
+		{"escaped double quote", `"say \"hi\""`, `say "hi"`},
+		{"backslash kept in double quotes", `"a\b"`, `a\b`},
+		{"quote of the other kind", `"it's"`, "it's"},
+		{"adjacent quotes", `a"b"'c'`, "abc"},
+		{"empty quotes", `""`, ""},
+		{"unterminated quote", `"abc`, `"abc`},
+		{"trailing backslash", `abc\`, `abc\`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NormalizeArgs([]string{tc.arg}); !slices.Equal(got, []string{tc.want}) {
+				t.Errorf("NormalizeArgs(%q) = %q, want [%q]", tc.arg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEqualArgsIgnoringQuotes(t *testing.T) {
+	measured := []string{"/bin/server", "--name=my app", "--flag"}
+	if !EqualArgsIgnoringQuotes(measured, []string{"/bin/server", `--name="my app"`, "'--flag'"}) {
+		t.Errorf("EqualArgsIgnoringQuotes() of quoted and unquoted equivalent args = false, want true")
+	}
+	if EqualArgsIgnoringQuotes(measured, []string{"/bin/server", "--name=my", "app", "--flag"}) {
+		t.Errorf("EqualArgsIgnoringQuotes() of differently split args = true, want false")
+	}
+	if EqualArgsIgnoringQuotes(measured, []string{"/bin/server", `--name="other app"`, "--flag"}) {
+		t.Errorf("EqualArgsIgnoringQuotes() of different args = true, want false")
+	}
+}
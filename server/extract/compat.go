@@ -0,0 +1,184 @@
+package extract
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+	"google.golang.org/protobuf/proto"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// launcherFormat is a row of the compatibility matrix: the COS event types
+// launchers from minVersion on may record.
+type launcherFormat struct {
+	minVersion *pb.SemanticVersion
+	eventTypes []coscel.ContentType
+}
+
+// launcherFormats is the compatibility matrix of this build, oldest format
+// first. Every listed event type is extracted by this build, so the formats
+// of launchers up to the major version of the newest row are fully
+// supported; a launcher of a newer major version may record features this
+// build does not know.
+var launcherFormats = []launcherFormat{
+	{
+		// Launchers predating the LauncherVersion event.
+		minVersion: &pb.SemanticVersion{},
+		eventTypes: []coscel.ContentType{
+			coscel.ImageRefType,
+			coscel.ImageDigestType,
+			coscel.RestartPolicyType,
+			coscel.ImageIDType,
+			coscel.ArgType,
+			coscel.EnvVarType,
+			coscel.OverrideArgType,
+			coscel.OverrideEnvType,
+			coscel.LaunchSeparatorType,
+			coscel.MemoryMonitorType,
+			coscel.GpuCCModeType,
+			coscel.GPUDeviceAttestationBindingType,
+		},
+	},
+	{
+		minVersion: &pb.SemanticVersion{Major: 1},
+		eventTypes: []coscel.ContentType{
+			coscel.LauncherVersionType,
+			coscel.LaunchFailedType,
+			coscel.PrivilegedType,
+			coscel.CapabilityType,
+			coscel.TeeTechnologyType,
+			coscel.DNSServerType,
+			coscel.DNSSearchDomainType,
+			coscel.MountType,
+			coscel.PlatformType,
+			coscel.SealingPolicyType,
+			coscel.LaunchPolicyType,
+			coscel.NonceType,
+			coscel.RunAsUserType,
+			coscel.ConfigHashType,
+			coscel.ImageCreatedType,
+			coscel.ProbeConfigType,
+			coscel.GrantedResourceType,
+			coscel.TerminationGracePeriodType,
+			coscel.RestartCountType,
+			coscel.KernelCmdlineType,
+			coscel.SignerType,
+			coscel.LoggingConfigType,
+			coscel.VulnerabilityScanType,
+			coscel.PlatformMismatchType,
+			coscel.InstanceMetadataType,
+			coscel.PullCredentialSourceType,
+			coscel.ReadOnlyRootfsType,
+			coscel.ExperimentalFeatureType,
+			coscel.SeccompProfileType,
+			coscel.SbomReferenceType,
+			coscel.NetworkModeType,
+			coscel.AcceleratorType,
+			coscel.TokenAudienceType,
+			coscel.ProvenanceReferenceType,
+			coscel.LifecycleHookType,
+			coscel.LayerDigestType,
+			coscel.UlimitType,
+			coscel.SourceRevisionType,
+			coscel.NamespaceSharingType,
+		},
+	},
+}
+
+// Compatibility reports whether this package can fully extract a COS event
+// log.
+type Compatibility struct {
+	// LauncherVersion is the launcher version recorded in the log, or nil if
+	// the log has no LauncherVersion event.
+	LauncherVersion *pb.SemanticVersion
+	// FormatVersion is the detected format version of the log: the
+	// LauncherVersion if recorded, otherwise the minimum launcher version of
+	// the newest format whose event types the log records.
+	FormatVersion *pb.SemanticVersion
+	// FullySupported is true if the format version is in the compatibility
+	// matrix of this build and every event in the log is understood by this
+	// package.
+	FullySupported bool
+	// UnsupportedFeatures names the features of the log this package does
+	// not understand: a format version newer than the compatibility matrix,
+	// then the unknown event types in order of first appearance.
+	UnsupportedFeatures []string
+}
+
+// CheckVersionCompatibility reports whether this build of the package fully
+// supports the COS event log format written by launchers of the version,
+// according to its compatibility matrix. Versions of a newer major version
+// than the matrix are partially supported: the event types this build knows
+// are still extracted. A nil version is the oldest format.
+func CheckVersionCompatibility(version *pb.SemanticVersion) *Compatibility {
+	if version == nil {
+		version = &pb.SemanticVersion{}
+	}
+	compat := &Compatibility{FormatVersion: version, FullySupported: true}
+	if newest := launcherFormats[len(launcherFormats)-1].minVersion; version.GetMajor() > newest.GetMajor() {
+		compat.FullySupported = false
+		compat.UnsupportedFeatures = []string{fmt.Sprintf("launcher version %d.%d.%d, newer than the supported major version %d", version.GetMajor(), version.GetMinor(), version.GetPatch(), newest.GetMajor())}
+	}
+	return compat
+}
+
+// CheckCompatibility reports whether this build of the package supports the
+// features used by the COS event log. The format version of the log is
+// detected from its LauncherVersion event, or from the event types it records
+// if it has none, and checked with CheckVersionCompatibility. As launcher
+// releases can add event types independently of the version, each event type
+// of the log is also matched against the compatibility matrix. Logs with
+// unsupported event types fail VerifiedCOSState unless handled through
+// Options.EventHandlers.
+//
+// CheckCompatibility does not verify the record digests; it only reports
+// whether extraction could succeed.
+func CheckCompatibility(eventLog cel.CEL, registerType uint8) (*Compatibility, error) {
+	var launcherVersion *pb.SemanticVersion
+	var unsupportedTypes []string
+	newestFormat := 0
+	for _, record := range eventLog.Records() {
+		if uint8(record.IndexType) != registerType {
+			return nil, fmt.Errorf("expect registerType: %d, but get %d in a CEL record", registerType, record.IndexType)
+		}
+		if !coscel.IsCOSTLV(record.Content) {
+			feature := fmt.Sprintf("non-COS content type %d", record.Content.Type)
+			if !slices.Contains(unsupportedTypes, feature) {
+				unsupportedTypes = append(unsupportedTypes, feature)
+			}
+			continue
+		}
+		cosTlv, err := coscel.ParseToCOSTLV(record.Content)
+		if err != nil {
+			return nil, err
+		}
+		format := slices.IndexFunc(launcherFormats, func(f launcherFormat) bool {
+			return slices.Contains(f.eventTypes, cosTlv.EventType)
+		})
+		if format == -1 {
+			feature := coscel.EventTypeName(cosTlv.EventType)
+			if !slices.Contains(unsupportedTypes, feature) {
+				unsupportedTypes = append(unsupportedTypes, feature)
+			}
+			continue
+		}
+		newestFormat = max(newestFormat, format)
+		if cosTlv.EventType == coscel.LauncherVersionType && launcherVersion == nil {
+			launcherVersion, err = parseSemanticVersion(string(cosTlv.EventContent))
+			if err != nil {
+				return nil, fmt.Errorf("invalid launcher version in COS eventlog: %v", err)
+			}
+		}
+	}
+	formatVersion := launcherVersion
+	if formatVersion == nil {
+		formatVersion = proto.Clone(launcherFormats[newestFormat].minVersion).(*pb.SemanticVersion)
+	}
+	compat := CheckVersionCompatibility(formatVersion)
+	compat.LauncherVersion = launcherVersion
+	compat.UnsupportedFeatures = append(compat.UnsupportedFeatures, unsupportedTypes...)
+	compat.FullySupported = len(compat.UnsupportedFeatures) == 0
+	return compat, nil
+}
@@ -0,0 +1,166 @@
+package extract
+
+import (
+	"crypto"
+	"slices"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+	"google.golang.org/protobuf/testing/protocmp"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	const futureType coscel.ContentType = 200
+	supported := []coscel.COSTLV{
+		{EventType: coscel.LauncherVersionType, EventContent: []byte("1.2.3")},
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	testCases := []struct {
+		name string
+		log  cel.CEL
+		want *Compatibility
+	}{
+		{
+			name: "empty log",
+			log:  cel.NewConfComputeMR(),
+			want: &Compatibility{FormatVersion: &pb.SemanticVersion{}, FullySupported: true},
+		},
+		{
+			name: "log without launcher version",
+			log: buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+				{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+				{EventType: coscel.PrivilegedType, EventContent: []byte("false")},
+			}),
+			want: &Compatibility{FormatVersion: &pb.SemanticVersion{Major: 1}, FullySupported: true},
+		},
+		{
+			name: "supported log",
+			log:  buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, supported),
+			want: &Compatibility{
+				LauncherVersion: &pb.SemanticVersion{Major: 1, Minor: 2, Patch: 3},
+				FormatVersion:   &pb.SemanticVersion{Major: 1, Minor: 2, Patch: 3},
+				FullySupported:  true,
+			},
+		},
+		{
+			name: "log of a newer launcher",
+			log: buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, append(slices.Clone(supported[1:]),
+				coscel.COSTLV{EventType: coscel.LauncherVersionType, EventContent: []byte("2.0.0")},
+				coscel.COSTLV{EventType: futureType, EventContent: []byte("a")},
+			)),
+			want: &Compatibility{
+				LauncherVersion:     &pb.SemanticVersion{Major: 2},
+				FormatVersion:       &pb.SemanticVersion{Major: 2},
+				UnsupportedFeatures: []string{"launcher version 2.0.0, newer than the supported major version 1", "ContentType(200)"},
+			},
+		},
+		{
+			name: "partially supported log",
+			log: buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, append(supported,
+				coscel.COSTLV{EventType: futureType, EventContent: []byte("a")},
+				coscel.COSTLV{EventType: futureType, EventContent: []byte("b")},
+				coscel.COSTLV{EventType: futureType + 1, EventContent: []byte("c")},
+			)),
+			want: &Compatibility{
+				LauncherVersion:     &pb.SemanticVersion{Major: 1, Minor: 2, Patch: 3},
+				FormatVersion:       &pb.SemanticVersion{Major: 1, Minor: 2, Patch: 3},
+				UnsupportedFeatures: []string{"ContentType(200)", "ContentType(201)"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CheckCompatibility(tc.log, uint8(cel.CCMRType))
+			if err != nil {
+				t.Fatalf("CheckCompatibility() returned error: %v", err)
+			}
+			if diff := cmp.Diff(got, tc.want, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected compatibility diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestCheckVersionCompatibility(t *testing.T) {
+	testCases := []struct {
+		name    string
+		version *pb.SemanticVersion
+		want    *Compatibility
+	}{
+		{
+			name: "no version",
+			want: &Compatibility{FormatVersion: &pb.SemanticVersion{}, FullySupported: true},
+		},
+		{
+			name:    "oldest format",
+			version: &pb.SemanticVersion{},
+			want:    &Compatibility{FormatVersion: &pb.SemanticVersion{}, FullySupported: true},
+		},
+		{
+			name:    "newest format",
+			version: &pb.SemanticVersion{Major: 1},
+			want:    &Compatibility{FormatVersion: &pb.SemanticVersion{Major: 1}, FullySupported: true},
+		},
+		{
+			name:    "newer minor version",
+			version: &pb.SemanticVersion{Major: 1, Minor: 42, Patch: 7},
+			want:    &Compatibility{FormatVersion: &pb.SemanticVersion{Major: 1, Minor: 42, Patch: 7}, FullySupported: true},
+		},
+		{
+			name:    "newer major version",
+			version: &pb.SemanticVersion{Major: 2, Minor: 1},
+			want: &Compatibility{
+				FormatVersion:       &pb.SemanticVersion{Major: 2, Minor: 1},
+				UnsupportedFeatures: []string{"launcher version 2.1.0, newer than the supported major version 1"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckVersionCompatibility(tc.version)
+			if diff := cmp.Diff(got, tc.want, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected compatibility diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestLauncherFormatsCoverEventTypes(t *testing.T) {
+	var types []coscel.ContentType
+	for _, format := range launcherFormats {
+		types = append(types, format.eventTypes...)
+	}
+	slices.Sort(types)
+	if diff := cmp.Diff(coscel.EventTypes(), types); diff != "" {
+		t.Errorf("compatibility matrix does not list every known event type exactly once (-want +got):\n%s", diff)
+	}
+}
+
+func TestCheckCompatibilityNonCOSRecord(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+	})
+	foreignEvent, err := generateNonCOSCELEvent([]crypto.Hash{crypto.SHA384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eventLog.AppendEvent(foreignEvent, []crypto.Hash{crypto.SHA384}, coscel.COSCCELMRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CheckCompatibility(eventLog, uint8(cel.CCMRType))
+	if err != nil {
+		t.Fatalf("CheckCompatibility() returned error: %v", err)
+	}
+	want := &Compatibility{FormatVersion: &pb.SemanticVersion{}, UnsupportedFeatures: []string{"non-COS content type 250"}}
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected compatibility diff: \n%v", diff)
+	}
+
+	if _, err := CheckCompatibility(eventLog, uint8(cel.PCRType)); err == nil {
+		t.Errorf("CheckCompatibility() with the wrong register type returned nil error, want error")
+	}
+}
@@ -0,0 +1,79 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
+	"google.golang.org/protobuf/proto"
+)
+
+// binaryContentDecoders decodes the content of the COS event types which are
+// not carried as a UTF-8 string.
+var binaryContentDecoders = map[coscel.ContentType]func([]byte) (any, error){
+	coscel.MemoryMonitorType: func(content []byte) (any, error) {
+		return decodeMemoryMonitor(content), nil
+	},
+	coscel.PrivilegedType: func(content []byte) (any, error) {
+		return parseBoolContent(content)
+	},
+	coscel.ReadOnlyRootfsType: func(content []byte) (any, error) {
+		return parseBoolContent(content)
+	},
+	coscel.GPUDeviceAttestationBindingType: func(content []byte) (any, error) {
+		return decodeGPUAttestationReport(content)
+	},
+	coscel.NonceType: func(content []byte) (any, error) {
+		return bytes.Clone(content), nil
+	},
+}
+
+// IsBinaryContent reports whether the content of the COS event type is binary
+// encoded rather than a UTF-8 string.
+func IsBinaryContent(eventType coscel.ContentType) bool {
+	_, ok := binaryContentDecoders[eventType]
+	return ok
+}
+
+// DecodeEventContent decodes the content of a COS event according to its
+// type. Binary encoded events decode to a bool for MemoryMonitor, Privileged
+// and ReadOnlyRootfs, to a *attestpb.NvidiaAttestationReport for
+// GPUDeviceAttestationBinding and to a []byte for Nonce. The content of every
+// other event, including unknown types, is returned as a string.
+func DecodeEventContent(cosTlv coscel.COSTLV) (any, error) {
+	decode, ok := binaryContentDecoders[cosTlv.EventType]
+	if !ok {
+		return string(cosTlv.EventContent), nil
+	}
+	content, err := decode(cosTlv.EventContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s event content: %v", coscel.EventTypeName(cosTlv.EventType), err)
+	}
+	return content, nil
+}
+
+// parseBoolContent parses a single byte boolean event content, 1 for true and
+// 0 for false.
+func parseBoolContent(content []byte) (bool, error) {
+	if len(content) != 1 || content[0] > 1 {
+		return false, fmt.Errorf("malformed boolean content %v, want a single 0 or 1 byte", content)
+	}
+	return content[0] == 1, nil
+}
+
+// decodeMemoryMonitor decodes the MemoryMonitor event content. Memory
+// monitoring is enabled only if the content is the single byte 1.
+func decodeMemoryMonitor(content []byte) bool {
+	return len(content) == 1 && content[0] == 1
+}
+
+// decodeGPUAttestationReport decodes the protobuf encoded
+// GPUDeviceAttestationBinding event content.
+func decodeGPUAttestationReport(content []byte) (*attestpb.NvidiaAttestationReport, error) {
+	report := &attestpb.NvidiaAttestationReport{}
+	if err := proto.Unmarshal(content, report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal GPU attestation report: %v", err)
+	}
+	return report, nil
+}
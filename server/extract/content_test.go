@@ -0,0 +1,49 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestDecodeEventContent(t *testing.T) {
+	report, reportBytes := testGpuReport(t)
+	testCases := []struct {
+		name    string
+		event   coscel.COSTLV
+		want    any
+		wantErr bool
+	}{
+		{"string event", coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")}, "docker.io/a:latest", false},
+		{"unknown event", coscel.COSTLV{EventType: 250, EventContent: []byte("custom")}, "custom", false},
+		{"memory monitor enabled", coscel.COSTLV{EventType: coscel.MemoryMonitorType, EventContent: []byte{1}}, true, false},
+		{"memory monitor disabled", coscel.COSTLV{EventType: coscel.MemoryMonitorType, EventContent: []byte{0}}, false, false},
+		{"privileged", coscel.COSTLV{EventType: coscel.PrivilegedType, EventContent: []byte{1}}, true, false},
+		{"malformed privileged", coscel.COSTLV{EventType: coscel.PrivilegedType, EventContent: []byte("true")}, nil, true},
+		{"GPU attestation report", coscel.COSTLV{EventType: coscel.GPUDeviceAttestationBindingType, EventContent: reportBytes}, report, false},
+		{"nonce", coscel.COSTLV{EventType: coscel.NonceType, EventContent: []byte{0, 1, 0xff}}, []byte{0, 1, 0xff}, false},
+		{"malformed GPU attestation report", coscel.COSTLV{EventType: coscel.GPUDeviceAttestationBindingType, EventContent: []byte{0xff}}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeEventContent(tc.event)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("DecodeEventContent() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("DecodeEventContent() returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsBinaryContent(t *testing.T) {
+	for _, eventType := range coscel.EventTypes() {
+		want := eventType == coscel.MemoryMonitorType || eventType == coscel.PrivilegedType || eventType == coscel.ReadOnlyRootfsType || eventType == coscel.GPUDeviceAttestationBindingType || eventType == coscel.NonceType
+		if got := IsBinaryContent(eventType); got != want {
+			t.Errorf("IsBinaryContent(%s) = %v, want %v", coscel.EventTypeName(eventType), got, want)
+		}
+	}
+}
@@ -3,23 +3,522 @@ package extract
 
 import (
 	"bytes"
+	"crypto"
 	"fmt"
+	"maps"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
-	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
 	"github.com/google/go-eventlog/cel"
 	"github.com/google/go-eventlog/register"
-	"google.golang.org/protobuf/proto"
 	pb "github.com/google/go-tpm-tools/proto/attest"
 )
 
+// DefaultMaxRecords is the maximum number of CEL records processed if
+// Options.MaxRecords is not set.
+const DefaultMaxRecords = 1 << 16
+
 // Options contains the options for parsing the COS event log.
 type Options struct {
 	PopulateGpuDeviceState bool // Whether to populate the GPU device state default is false.
+	// AllowedPCRIndices lists the PCRs COS events may be measured into.
+	// Defaults to coscel.EventPCRIndex if empty.
+	AllowedPCRIndices []uint8
+	// AllowedCCMRIndices lists the CCMRs COS events may be measured into.
+	// Defaults to coscel.COSCCELMRIndex if empty.
+	AllowedCCMRIndices []uint8
+	// PopulateRawContents records the raw content of every COS event in
+	// COSState.RawContents.
+	PopulateRawContents bool
+	// RequiredDigestAlgs lists the digest algorithms every COS record must
+	// carry a digest for. All digests present in a record are verified
+	// regardless of this option.
+	RequiredDigestAlgs []crypto.Hash
+	// VerifyDigestAlgs restricts digest verification to the given digest
+	// algorithms, e.g. the bank of the quoted register. Digests of other
+	// algorithms are ignored, and every record must carry a digest for each
+	// listed algorithm. All present digests are verified if empty.
+	VerifyDigestAlgs []crypto.Hash
+	// AllowLaunchFailure returns the state of a log with a LaunchFailed event
+	// instead of failing extraction.
+	AllowLaunchFailure bool
+	// SkipNonCOSRecords ignores records whose content is not a COS TLV, such
+	// as UEFI events interleaved in a full boot log, instead of failing. Only
+	// records outside the allowed COS indices are skipped; non-COS content
+	// measured into a COS register is still an error, since a COS record with
+	// a tampered type byte would otherwise silently drop out of the log.
+	SkipNonCOSRecords bool
+	// VerifySkippedRecordDigests verifies the digests of records skipped by
+	// SkipNonCOSRecords against their content TLV. Records whose digests are
+	// not computed over the TLV, such as real UEFI events, fail verification.
+	VerifySkippedRecordDigests bool
+	// AllowedEnvNames restricts the env var and overridden env var names the
+	// log may contain. No restriction is applied if nil.
+	AllowedEnvNames []string
+	// EventHandlers maps COS content types not handled by this package to
+	// handlers for their event content. This lets callers extract custom
+	// event types, e.g. into fields of their own, without failing on them.
+	// Handlers are not consulted for the built-in types.
+	EventHandlers map[coscel.ContentType]EventHandler
+	// MaxRecords is the maximum number of CEL records to process. Logs with
+	// more records are rejected before any record is processed. Defaults to
+	// DefaultMaxRecords if zero.
+	MaxRecords int
+	// ValidateImageConsistency applies ValidateImageConsistency to the
+	// extracted container state.
+	ValidateImageConsistency bool
+	// Tolerant collects the errors of individual COS events, such as
+	// malformed or duplicate events, instead of failing on the first one.
+	// Extraction then returns the state assembled from the remaining events
+	// together with a *MultiError listing every problem. Errors affecting the
+	// soundness of the log, such as register or digest verification failures,
+	// are always fatal, unless InsecureTolerateDigestFailures is set.
+	Tolerant bool
+	// RejectNULArgs fails extraction if an arg or overridden arg contains a
+	// NUL byte. Such args cannot be passed to a process, so they indicate a
+	// corrupted or crafted log.
+	RejectNULArgs bool
+	// NormalizeRestartPolicy trims whitespace from the RestartPolicy event
+	// and matches it case-insensitively, accepting e.g. " onfailure" as
+	// OnFailure. The policy must match a pb.RestartPolicy name exactly if
+	// unset.
+	NormalizeRestartPolicy bool
+	// PopulateEvents records every processed COS record in COSState.Events,
+	// keeping the full event timeline alongside the collapsed state.
+	PopulateEvents bool
+	// ReservedEnvNames lists env var names reserved for the launcher, which
+	// the env vars and overridden env vars of the log must not set.
+	ReservedEnvNames []string
+	// WarnOnReservedEnvNames reports env vars colliding with
+	// ReservedEnvNames in COSState.Warnings instead of failing extraction.
+	WarnOnReservedEnvNames bool
+	// RequireSeparator fails extraction of a log without a LaunchSeparator
+	// event, which may be an incomplete or pre-launch measurement.
+	RequireSeparator bool
+	// InsecureTolerateDigestFailures, together with Tolerant, reports COS
+	// records failing digest verification in COSState.Warnings and applies
+	// them anyway, instead of failing extraction. This is only meant for
+	// forensic analysis of tampered logs: the extracted state is then not
+	// bound to the measured registers and must not be trusted.
+	InsecureTolerateDigestFailures bool
+	// OnEvent is called with every verified COS event, in log order, before
+	// it is applied. Returning an error aborts extraction immediately, before
+	// the remaining records are processed, even with Tolerant. Records which
+	// failed digest verification under InsecureTolerateDigestFailures are not
+	// passed to OnEvent. See DenyImageDigests.
+	OnEvent func(cosTlv coscel.COSTLV) error
+	// CustomRegisterTypes registers register types COS events may be
+	// measured into besides cel.PCRType and cel.CCMRType, keyed by the
+	// IndexType of their records, e.g. for platforms not yet supported by
+	// this package. The built-in types cannot be redefined.
+	CustomRegisterTypes map[cel.MRType]RegisterType
+	// MaxOverriddenArgs is the maximum number of overridden args, limiting
+	// how far an operator can change the launch template. Unlimited if zero.
+	MaxOverriddenArgs int
+	// MaxOverriddenEnvVars is the maximum number of overridden env vars.
+	// Unlimited if zero.
+	MaxOverriddenEnvVars int
+	// MaxDistinctEnvVars is the maximum number of distinct env var names
+	// across the env vars and overridden env vars, a name set both ways
+	// counting once. Exceeding it aborts extraction immediately, before the
+	// remaining records are processed, even with Tolerant. Unlimited if zero.
+	MaxDistinctEnvVars int
+	// MaxArgsCount is the maximum number of args and overridden args
+	// together. Unlimited if zero.
+	MaxArgsCount int
+	// MaxArgsBytes is the maximum combined length in bytes of the args and
+	// overridden args, bounding the size of the command line. Unlimited if
+	// zero.
+	MaxArgsBytes int
+	// DeriveImageDigest sets Container.ImageDigest from an image reference
+	// pinned by digest (repo@sha256:...) if the log has no ImageDigest event,
+	// and reports it in ContainerExtensions.ImageDigestDerived.
+	DeriveImageDigest bool
+	// DigestVerifier, if set, verifies the digests of every record in place
+	// of cel.VerifyDigests, e.g. to hash with an HSM or a remote service. It
+	// is called with the record, its content and the digests to verify, as
+	// selected by VerifyDigestAlgs, and must fail if any digest mismatches.
+	DigestVerifier func(record cel.Record, content cel.Content, digests map[crypto.Hash][]byte) error
+	// PopulateDigestAlgs records the digest algorithms of every processed
+	// COS record in COSState.DigestAlgs, e.g. to audit logs mixing weak and
+	// strong algorithms.
+	PopulateDigestAlgs bool
+}
+
+// EventHandler handles the content of a custom COS event type, see
+// Options.EventHandlers. Returning an error fails the extraction.
+type EventHandler func(state *COSState, content []byte) error
+
+// COSState is the state extracted from a COS event log. It embeds the
+// AttestedCosState and carries the extracted data which has no field in it.
+type COSState struct {
+	*pb.AttestedCosState
+	// RawContents maps each COS event type to the raw content of its events,
+	// in the order they appear in the log. Only populated if
+	// Options.PopulateRawContents is set.
+	RawContents map[coscel.ContentType][][]byte
+	// LaunchFailed is true if the log contains a LaunchFailed event, meaning
+	// the workload did not start cleanly.
+	LaunchFailed bool
+	// LaunchError is the failure reason recorded in the LaunchFailed event.
+	LaunchError string
+	// ContainerExtensions holds the container state which has no field in
+	// pb.ContainerState.
+	ContainerExtensions *ContainerExtensions
+	// TeeTechnology is the confidential computing technology the workload
+	// ran on, or NONE if not recorded.
+	TeeTechnology pb.GCEConfidentialTechnology
+	// LaunchSeparatorPayload is the content of the LaunchSeparator event, such
+	// as a phase name or reason, or empty if the separator has no payload or
+	// is absent.
+	LaunchSeparatorPayload string
+	// SealingPolicy is the identifier or hash of the policy the workload
+	// sealed its secrets to, or empty if not recorded.
+	SealingPolicy string
+	// LaunchPolicy is the launch policy of the image, or nil if not recorded.
+	LaunchPolicy *LaunchPolicy
+	// Nonce is the attestation nonce or challenge bound into the log, or nil
+	// if not recorded.
+	Nonce []byte
+	// ConfigHash is the digest of the full workload configuration, of the
+	// form <algorithm>:<encoded>, or empty if not recorded.
+	ConfigHash string
+	// GrantedResources lists the identifiers of the secrets and resources
+	// the workload was granted access to, in log order.
+	GrantedResources []string
+	// Events lists every processed COS record in log order. Only populated if
+	// Options.PopulateEvents is set.
+	Events []Event
+	// Warnings lists the problems found in the log which options chose to
+	// report instead of failing extraction.
+	Warnings []string
+	// BootState is the boot configuration of the COS host.
+	BootState BootState
+	// InstanceMetadata is the identity of the VM instance the workload ran
+	// on, or nil if not recorded.
+	InstanceMetadata *InstanceMetadata
+	// DigestAlgs maps the record number of every processed COS record to the
+	// sorted digest algorithms of its digests. Only populated if
+	// Options.PopulateDigestAlgs is set.
+	DigestAlgs map[uint64][]crypto.Hash
+	// ExperimentalFeatures lists the experimental launcher features enabled
+	// for the workload, in log order.
+	ExperimentalFeatures []string
+	// TokenAudiences is the set of audiences the workload requested OIDC
+	// identity tokens for. Requesting an audience several times records it
+	// once.
+	TokenAudiences map[string]struct{}
+}
+
+// InstanceMetadata is the identity of a Compute Engine VM instance.
+type InstanceMetadata struct {
+	ProjectID  string
+	Zone       string
+	InstanceID uint64
+}
+
+// BootState is the boot configuration of the COS host recorded in the event
+// log.
+type BootState struct {
+	// KernelCmdline is the kernel command line, or empty if not recorded.
+	KernelCmdline string
+}
+
+// Event is a COS record of the event log, see Options.PopulateEvents.
+type Event struct {
+	// RecNum is the record number of the CEL record.
+	RecNum uint64
+	// Index is the register index the record is measured into.
+	Index uint8
+	// Type is the COS event type.
+	Type coscel.ContentType
+	// Content is the raw event content.
+	Content []byte
+	// DigestVerified is whether the record digests were verified against the
+	// content.
+	DigestVerified bool
+	// Applied is whether the event was applied to the state. Events are only
+	// rejected without failing the extraction with Options.Tolerant.
+	Applied bool
+}
+
+// ContainerExtensions is the container state extracted from the COS event log
+// in addition to pb.ContainerState.
+type ContainerExtensions struct {
+	// Privileged is whether the container ran privileged, or nil if not
+	// recorded.
+	Privileged *bool
+	// Capabilities lists the Linux capabilities granted to the container, in
+	// log order.
+	Capabilities []string
+	// DNS is the resolver configuration of the container.
+	DNS DNSConfig
+	// Mounts lists the volumes mounted into the container, in log order.
+	Mounts []Mount
+	// Platform is the platform of the container image, or nil if not
+	// recorded.
+	Platform *Platform
+	// RunAsUser is the user the container process ran as, in the
+	// "<user>[:<group>]" form of the RunAsUser event, or empty if not
+	// recorded.
+	RunAsUser string
+	// RunAsUID is the UID of RunAsUser if the user is numeric, or nil.
+	RunAsUID *uint32
+	// ImageCreated is the creation time of the container image, or the zero
+	// time if not recorded.
+	ImageCreated time.Time
+	// Probes lists the health check probes configured for the container, in
+	// log order.
+	Probes []ProbeConfig
+	// TerminationGracePeriod is the time the container is given to stop
+	// before it is killed, or nil if not recorded.
+	TerminationGracePeriod *time.Duration
+	// RestartCount is the number of times the container was restarted, or
+	// nil if not recorded.
+	RestartCount *uint32
+	// Signers lists the identities of the attestors which signed the
+	// container image, in log order.
+	Signers []string
+	// LoggingConfig is where the container's stdout and stderr are sent, or
+	// nil if not recorded.
+	LoggingConfig *LoggingConfig
+	// VulnerabilityScan is the vulnerability scan result of the container
+	// image, or nil if not recorded.
+	VulnerabilityScan *VulnerabilityScan
+	// HostPlatform is the platform of the host if it did not match the
+	// platform requested for the image, which then ran under emulation, or
+	// nil if no mismatch was recorded.
+	HostPlatform *Platform
+	// PullCredentialSource is how the image pull was authenticated, or empty
+	// if not recorded.
+	PullCredentialSource CredentialSource
+	// ReadOnlyRootfs is whether the container root filesystem was mounted
+	// read-only, or nil if not recorded.
+	ReadOnlyRootfs *bool
+	// SeccompProfile is the seccomp profile applied to the container:
+	// SeccompProfileDefault, SeccompProfileUnconfined, or a named profile of
+	// the form "localhost/<name>". Empty if not recorded.
+	SeccompProfile string
+	// SbomReference identifies the Software Bill of Materials of the
+	// container image, e.g. the reference of an attached SBOM artifact, or
+	// empty if not recorded.
+	SbomReference string
+	// ProvenanceReference identifies the in-toto provenance attestation of
+	// the container image, e.g. for SLSA policies, or empty if not recorded.
+	ProvenanceReference string
+	// SourceRevision is the git commit the container image was built from,
+	// as a lowercase hex SHA-1 or SHA-256 object name, or empty if not
+	// recorded.
+	SourceRevision string
+	// NetworkMode is the network mode of the container: NetworkModeHost,
+	// NetworkModeBridge or NetworkModeNone. Empty if not recorded.
+	NetworkMode string
+	// Accelerators lists the GPUs and other accelerators attached to the
+	// container, in log order.
+	Accelerators []Accelerator
+	// LifecycleHooks lists the lifecycle hooks configured for the container,
+	// in log order.
+	LifecycleHooks []LifecycleHook
+	// LayerDigests lists the digests of the container image layers, of the
+	// form <algorithm>:<encoded>, from the base layer up.
+	LayerDigests []string
+	// Ulimits lists the resource limits of the container process, in log
+	// order.
+	Ulimits []Ulimit
+	// ImageDigestDerived is whether Container.ImageDigest was derived from
+	// the image reference rather than measured by an ImageDigest event. See
+	// Options.DeriveImageDigest.
+	ImageDigestDerived bool
+	// NamespaceSharing is which Linux namespaces the container shared with
+	// the host.
+	NamespaceSharing NamespaceSharing
+}
+
+// NamespaceSharing records whether the container shared its PID and IPC
+// namespaces with the host. Each mode is NamespaceModeHost or
+// NamespaceModePrivate, or empty if not recorded.
+type NamespaceSharing struct {
+	PID string
+	IPC string
+}
+
+const (
+	// NamespaceModeHost shares the namespace of the host.
+	NamespaceModeHost = "host"
+	// NamespaceModePrivate gives the container its own namespace.
+	NamespaceModePrivate = "private"
+)
+
+// Ulimit is a resource limit of the container process, e.g. nofile.
+type Ulimit struct {
+	Name string
+	Soft uint64
+	Hard uint64
+}
+
+// LifecycleHook is a command run by the container runtime at a point of the
+// container lifecycle.
+type LifecycleHook struct {
+	// Kind is when the hook runs: "poststart" or "prestop".
+	Kind string
+	// Command is the command the hook runs.
+	Command string
+}
+
+// Accelerator is a kind of accelerator device attached to the container.
+type Accelerator struct {
+	// Type is the device type, e.g. "nvidia-h100-80gb".
+	Type string
+	// Count is the number of attached devices of the type.
+	Count uint32
+}
+
+const (
+	// SeccompProfileDefault is the container runtime's default seccomp
+	// profile.
+	SeccompProfileDefault = "default"
+	// SeccompProfileUnconfined means no seccomp filtering.
+	SeccompProfileUnconfined = "unconfined"
+)
+
+const (
+	// NetworkModeHost shares the network namespace of the host.
+	NetworkModeHost = "host"
+	// NetworkModeBridge connects the container to a bridge network.
+	NetworkModeBridge = "bridge"
+	// NetworkModeNone isolates the container without network access.
+	NetworkModeNone = "none"
+)
+
+// CredentialSource is how a container image pull was authenticated.
+type CredentialSource string
+
+const (
+	// CredentialSourceAnonymous is a pull without credentials.
+	CredentialSourceAnonymous CredentialSource = "anonymous"
+	// CredentialSourceServiceAccount is a pull with a token of the VM's
+	// service account.
+	CredentialSourceServiceAccount CredentialSource = "service_account"
+	// CredentialSourceWorkloadIdentity is a pull with federated workload
+	// identity credentials.
+	CredentialSourceWorkloadIdentity CredentialSource = "workload_identity"
+	// CredentialSourceKey is a pull with a service account key.
+	CredentialSourceKey CredentialSource = "key"
+)
+
+// ProbeConfig is a health check probe of the container.
+type ProbeConfig struct {
+	// Kind is the probe kind: "liveness", "readiness" or "startup".
+	Kind string
+	// Type is how the probe checks the container: "http", "tcp" or "exec".
+	Type string
+	// Target is the HTTP path, TCP port or command probed.
+	Target string
+	// Period is the interval between probes, or zero if not recorded.
+	Period time.Duration
+	// Timeout is the probe timeout, or zero if not recorded.
+	Timeout time.Duration
+}
+
+// Platform is the OS and architecture of a container image.
+type Platform struct {
+	OS           string
+	Architecture string
+	// Variant is the optional CPU variant, e.g. "v8" for linux/arm64/v8.
+	Variant string
+}
+
+// String returns the platform in os/arch[/variant] form.
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
+
+// LoggingConfig is where the container's stdout and stderr are sent.
+type LoggingConfig struct {
+	// CloudLogging is whether the logs are sent to Cloud Logging.
+	CloudLogging bool
+	// Serial is whether the logs are written to the serial console.
+	Serial bool
+}
+
+// Enabled reports whether the logs are sent anywhere.
+func (c LoggingConfig) Enabled() bool {
+	return c.CloudLogging || c.Serial
+}
+
+// VulnerabilityScan is the vulnerability scan result of a container image.
+type VulnerabilityScan struct {
+	// Clean is whether the scan found no vulnerabilities. A flagged image
+	// is not clean.
+	Clean bool
+	// Attestation identifies the scan attestation, e.g. a Container
+	// Analysis occurrence name.
+	Attestation string
+}
+
+// Mount is a volume mounted into the container.
+type Mount struct {
+	// Type is the mount type, e.g. "bind" or "tmpfs".
+	Type string
+	// Source is the host path or volume name, empty for tmpfs mounts.
+	Source string
+	// Target is the mount path in the container.
+	Target string
+	// ReadOnly is whether the mount is read-only.
+	ReadOnly bool
+}
+
+// DNSConfig is the DNS resolver configuration of the container.
+type DNSConfig struct {
+	// Servers lists the nameserver IP addresses, in log order.
+	Servers []string
+	// SearchDomains lists the DNS search domains, in log order.
+	SearchDomains []string
+}
+
+// checkRecordCount returns an error if there are more records than
+// Options.MaxRecords.
+func (opts Options) checkRecordCount(records []cel.Record) error {
+	maxRecords := opts.MaxRecords
+	if maxRecords == 0 {
+		maxRecords = DefaultMaxRecords
+	}
+	if len(records) > maxRecords {
+		return fmt.Errorf("COS CEL log has %d records, exceeding the maximum of %d", len(records), maxRecords)
+	}
+	return nil
+}
+
+// allowedIndices returns the register indices COS events are expected in for
+// the given register type.
+func (opts Options) allowedIndices(registerType cel.MRType) []uint8 {
+	switch registerType {
+	case cel.PCRType:
+		if len(opts.AllowedPCRIndices) > 0 {
+			return opts.AllowedPCRIndices
+		}
+		return []uint8{coscel.EventPCRIndex}
+	case cel.CCMRType:
+		if len(opts.AllowedCCMRIndices) > 0 {
+			return opts.AllowedCCMRIndices
+		}
+		return []uint8{coscel.COSCCELMRIndex}
+	default:
+		return opts.CustomRegisterTypes[registerType].AllowedIndices
+	}
 }
 
 // ParseCOSCEL takes an encoded Attested COS CEL and MR bank, replays the CEL against the MRs,
-// and returns the AttestedCosState.
+// and returns the AttestedCosState. If the CEL ends in the middle of a record, the
+// returned error wraps ErrTruncatedLog.
 func ParseCOSCEL(cosEventLog []byte, p register.MRBank, opts Options) (*pb.AttestedCosState, error) {
 	switch p.(type) {
 	case register.PCRBank:
@@ -32,10 +531,14 @@ func ParseCOSCEL(cosEventLog []byte, p register.MRBank, opts Options) (*pb.Attes
 }
 
 func getCOSStateFromCEL(rawCanonicalEventLog []byte, register register.MRBank, trustingRegisterType cel.MRType, opts Options) (*pb.AttestedCosState, error) {
-	decodedCEL, err := cel.DecodeToCEL(bytes.NewBuffer(rawCanonicalEventLog))
+	decodedCEL, err := decodeCOSCEL(rawCanonicalEventLog)
 	if err != nil {
 		return nil, err
 	}
+	// Bound the work done on an untrusted log before replaying it.
+	if err := opts.checkRecordCount(decodedCEL.Records()); err != nil {
+		return nil, err
+	}
 	// Validate the COS event log first.
 	if err := decodedCEL.Replay(register); err != nil {
 		return nil, err
@@ -49,130 +552,1192 @@ func getCOSStateFromCEL(rawCanonicalEventLog []byte, register register.MRBank, t
 	return cosState, err
 }
 
+// decodeCOSCEL decodes a raw canonical event log. If the log ends in the middle
+// of a record, the returned error wraps ErrTruncatedLog.
+func decodeCOSCEL(rawCanonicalEventLog []byte) (cel.CEL, error) {
+	decodedCEL, err := cel.DecodeToCEL(bytes.NewBuffer(rawCanonicalEventLog))
+	if err != nil {
+		if isTruncatedCEL(rawCanonicalEventLog) {
+			return nil, fmt.Errorf("%w: %v", ErrTruncatedLog, err)
+		}
+		return nil, err
+	}
+	return decodedCEL, nil
+}
+
 // VerifiedCOSState returns the AttestedCosState from the given event log.
+// Container.Args and Container.OverriddenArgs hold the args in the order of
+// their events in the log, which is the order they are passed to the
+// container.
+//
+// With Options.Tolerant, the state is returned together with a *MultiError
+// if some events could not be applied.
 func VerifiedCOSState(eventLog cel.CEL, registerType uint8, opts Options) (*pb.AttestedCosState, error) {
-	cosState := &pb.AttestedCosState{}
+	state, err := ExtractCOSState(eventLog, registerType, opts)
+	if state == nil {
+		return nil, err
+	}
+	return state.AttestedCosState, err
+}
+
+// ExtractCOSState returns the COSState from the given event log. With
+// Options.Tolerant, the state is returned together with a *MultiError if some
+// events could not be applied.
+func ExtractCOSState(eventLog cel.CEL, registerType uint8, opts Options) (*COSState, error) {
+	return extractCOSState(eventLog.Records(), registerType, opts, nil)
+}
+
+// DetectRegisterType returns the register type the COS events of the log are
+// measured into, for use with VerifiedCOSState and ExtractCOSState. The type
+// is taken from the records rather than trusted from eventLog.MRType(), and
+// every record must be of that type and measured into one of the COS indices
+// allowed by opts. An empty log reports eventLog.MRType().
+func DetectRegisterType(eventLog cel.CEL, opts Options) (uint8, error) {
+	if err := opts.checkRegisterTypes(); err != nil {
+		return 0, err
+	}
+	records := eventLog.Records()
+	if len(records) == 0 {
+		registerType := eventLog.MRType()
+		if opts.allowedIndices(registerType) == nil {
+			return 0, fmt.Errorf("unknown COS CEL log index type %d", registerType)
+		}
+		return uint8(registerType), nil
+	}
+
+	registerType := records[0].IndexType
+	allowedIndices := opts.allowedIndices(registerType)
+	if allowedIndices == nil {
+		return 0, fmt.Errorf("unknown COS CEL log index type %d", registerType)
+	}
+	for _, record := range records {
+		if record.IndexType != registerType {
+			return 0, fmt.Errorf("CEL record %d has register type %d, but the log was detected as %d", record.RecNum, record.IndexType, registerType)
+		}
+		if opts.skipNonCOSRecord(record) {
+			continue
+		}
+		if !slices.Contains(allowedIndices, record.Index) {
+			return 0, fmt.Errorf("CEL record %d has unexpected register index %d for register type %d", record.RecNum, record.Index, registerType)
+		}
+		if opts.SkipNonCOSRecords && !coscel.IsCOSTLV(record.Content) {
+			return 0, fmt.Errorf("CEL record %d in COS register index %d is not a COS TLV", record.RecNum, record.Index)
+		}
+	}
+	return uint8(registerType), nil
+}
+
+// IsCOSEventLog reports whether the log looks like the event log of a
+// Confidential Space workload, i.e. contains an ImageRef or LaunchSeparator
+// event of registerType, which every COS launch measures. It is a heuristic
+// to detect extraction pointed at the wrong log, e.g. one with only foreign
+// content types, and verifies nothing: a log it accepts may still fail
+// extraction.
+func IsCOSEventLog(eventLog cel.CEL, registerType uint8) bool {
+	for _, record := range eventLog.Records() {
+		if uint8(record.IndexType) != registerType || !coscel.IsCOSTLV(record.Content) {
+			continue
+		}
+		cosTlv, err := coscel.ParseToCOSTLV(record.Content)
+		if err != nil {
+			continue
+		}
+		if cosTlv.EventType == coscel.ImageRefType || cosTlv.EventType == coscel.LaunchSeparatorType {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractPhase returns the AttestedCosState assembled from the records of the
+// given launch phase. Phases are delimited by LaunchSeparator events: phase 0
+// holds the records before the first separator, phase 1 the records between
+// the first and second separator, and so on. The records after the last
+// separator form a final phase only if there are any. All records in the log
+// are verified, not only those of the selected phase.
+func ExtractPhase(eventLog cel.CEL, registerType uint8, phase int) (*pb.AttestedCosState, error) {
+	opts := Options{}
+	if err := opts.checkRecordCount(eventLog.Records()); err != nil {
+		return nil, err
+	}
+	var phases [][]cel.Record
+	var current []cel.Record
+	for _, record := range eventLog.Records() {
+		cosTlv, err := verifyCOSRecord(record, registerType, opts)
+		if err != nil {
+			return nil, err
+		}
+		if cosTlv.EventType == coscel.LaunchSeparatorType {
+			phases = append(phases, current)
+			current = nil
+			continue
+		}
+		current = append(current, record)
+	}
+	if len(current) > 0 {
+		phases = append(phases, current)
+	}
+	if phase < 0 || phase >= len(phases) {
+		return nil, fmt.Errorf("phase %d out of range, COS event log has %d phase(s)", phase, len(phases))
+	}
+
+	state, err := extractCOSState(phases[phase], registerType, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return state.AttestedCosState, nil
+}
+
+// extractCOSState extracts the state from records. If sources is not nil, the
+// RecNum of the record each field is extracted from is recorded in it.
+func extractCOSState(records []cel.Record, registerType uint8, opts Options, sources FieldSources) (*COSState, error) {
+	if err := opts.checkRegisterTypes(); err != nil {
+		return nil, err
+	}
+	if err := opts.checkRecordCount(records); err != nil {
+		return nil, err
+	}
+	state := &COSState{AttestedCosState: &pb.AttestedCosState{}}
+	if opts.PopulateRawContents {
+		state.RawContents = make(map[coscel.ContentType][][]byte)
+	}
+	if opts.PopulateDigestAlgs {
+		state.DigestAlgs = make(map[uint64][]crypto.Hash)
+	}
+	cosState := state.AttestedCosState
 	cosState.Container = &pb.ContainerState{}
 	cosState.HealthMonitoring = &pb.HealthMonitoringState{}
 	cosState.GpuDeviceState = &pb.GpuDeviceState{}
 	cosState.Container.Args = make([]string, 0)
 	cosState.Container.EnvVars = make(map[string]string)
 	cosState.Container.OverriddenEnvVars = make(map[string]string)
+	state.ContainerExtensions = &ContainerExtensions{}
 
+	var errs []error
 	seenSeparator := false
-	for _, record := range eventLog.Records() {
-		if uint8(record.IndexType) != registerType {
-			return nil, fmt.Errorf("expect registerType: %d, but get %d in a CEL record", registerType, record.IndexType)
+	envNames := make(map[string]struct{})
+	for _, record := range records {
+		if opts.skipNonCOSRecord(record) {
+			if err := verifySkippedRecord(record, registerType, opts); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		switch record.IndexType {
-		case cel.PCRType:
-			if record.Index != coscel.EventPCRIndex {
-				return nil, fmt.Errorf("found unexpected PCR %d in COS CEL log", record.Index)
+		cosTlv, err := parseCOSRecord(record, registerType, opts)
+		if err != nil {
+			return nil, err
+		}
+		digestVerified := true
+		// verify digests for the cos cel content
+		if err := verifyRecordDigests(cosTlv, record, opts); err != nil {
+			if !opts.Tolerant || !opts.InsecureTolerateDigestFailures {
+				return nil, err
 			}
-		case cel.CCMRType:
-			if record.Index != coscel.COSCCELMRIndex {
-				return nil, fmt.Errorf("found unexpected CCELMR %d in COS CEL log", record.Index)
+			digestVerified = false
+			state.Warnings = append(state.Warnings, fmt.Sprintf("INSECURE: CEL record %d failed digest verification, its content is untrusted: %v", record.RecNum, err))
+		}
+
+		if opts.OnEvent != nil && digestVerified {
+			if err := opts.OnEvent(cosTlv); err != nil {
+				return nil, fmt.Errorf("CEL record %d: %w", record.RecNum, err)
 			}
-		default:
-			return nil, fmt.Errorf("unknown COS CEL log index type %d", record.IndexType)
 		}
 
-		// The Content.Type is not verified at this point, so we have to fail
-		// if we see any events that we do not understand. This ensures that
-		// we either verify the digest of event event in this PCR/RTMA, or we
-		// fail to replay the event log.
-		// TODO: See if we can fix this to have the Content Type be verified.
-		cosTlv, err := coscel.ParseToCOSTLV(record.Content)
-		if err != nil {
-			return nil, err
+		if opts.PopulateDigestAlgs {
+			state.DigestAlgs[record.RecNum] = slices.Sorted(maps.Keys(record.Digests))
 		}
 
-		// verify digests for the cos cel content
-		if err := cel.VerifyDigests(cosTlv, record.Digests); err != nil {
-			return nil, err
+		var event *Event
+		if opts.PopulateEvents {
+			state.Events = append(state.Events, Event{
+				RecNum:         record.RecNum,
+				Index:          record.Index,
+				Type:           cosTlv.EventType,
+				Content:        bytes.Clone(cosTlv.EventContent),
+				DigestVerified: digestVerified,
+			})
+			event = &state.Events[len(state.Events)-1]
 		}
 
 		// TODO: Add support for post-separator container data
 		if seenSeparator {
-			return nil, fmt.Errorf("found COS Event Type %v after LaunchSeparator event", cosTlv.EventType)
+			err := fmt.Errorf("found COS Event Type %v after LaunchSeparator event", cosTlv.EventType)
+			if cosTlv.EventType == coscel.LaunchSeparatorType {
+				// Only ExtractPhase accepts a log with several launch phases.
+				err = fmt.Errorf("found second LaunchSeparator event")
+			}
+			if !opts.Tolerant {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("CEL record %d: %w", record.RecNum, err))
+			continue
+		}
+
+		if opts.PopulateRawContents {
+			state.RawContents[cosTlv.EventType] = append(state.RawContents[cosTlv.EventType], bytes.Clone(cosTlv.EventContent))
 		}
 
-		switch cosTlv.EventType {
-		case coscel.ImageRefType:
-			if cosState.Container.GetImageReference() != "" {
-				return nil, fmt.Errorf("found more than one ImageRef event")
+		if err := opts.checkDistinctEnvVars(envNames, cosTlv); err != nil {
+			return nil, fmt.Errorf("CEL record %d: %w", record.RecNum, err)
+		}
+
+		if err := applyCOSEvent(state, cosTlv, opts); err != nil {
+			if !opts.Tolerant {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("CEL record %d: %w", record.RecNum, err))
+		} else {
+			if event != nil {
+				event.Applied = true
+			}
+			if sources != nil {
+				if field := sourceField(state, cosTlv); field != "" {
+					sources[field] = record.RecNum
+				}
+			}
+		}
+		if cosTlv.EventType == coscel.LaunchSeparatorType {
+			seenSeparator = true
+		}
+	}
+	if opts.DeriveImageDigest && cosState.Container.ImageDigest == "" {
+		if digest, ok := referenceDigest(cosState.Container.ImageReference); ok {
+			cosState.Container.ImageDigest = digest
+			state.ContainerExtensions.ImageDigestDerived = true
+			if recNum, ok := sources["Container.ImageReference"]; ok {
+				sources["Container.ImageDigest"] = recNum
 			}
-			cosState.Container.ImageReference = string(cosTlv.EventContent)
+		}
+	}
+	if opts.RequireSeparator && !seenSeparator {
+		err := fmt.Errorf("found no LaunchSeparator event in COS eventlog")
+		if !opts.Tolerant {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	if err := checkCOSState(state, opts); err != nil {
+		if !opts.Tolerant {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return state, &MultiError{Errs: errs}
+	}
+	return state, nil
+}
+
+// applyCOSEvent applies a verified COS event to the state.
+func applyCOSEvent(state *COSState, cosTlv coscel.COSTLV, opts Options) error {
+	cosState := state.AttestedCosState
+	containerExt := state.ContainerExtensions
+
+	switch cosTlv.EventType {
+	case coscel.ImageRefType:
+		if cosState.Container.GetImageReference() != "" {
+			return fmt.Errorf("found more than one ImageRef event")
+		}
+		cosState.Container.ImageReference = string(cosTlv.EventContent)
+
+	case coscel.ImageDigestType:
+		if cosState.Container.GetImageDigest() != "" {
+			return fmt.Errorf("found more than one ImageDigest event")
+		}
+		cosState.Container.ImageDigest = string(cosTlv.EventContent)
+
+	case coscel.RestartPolicyType:
+		restartPolicy, ok := lookupRestartPolicy(string(cosTlv.EventContent), opts.NormalizeRestartPolicy)
+		if !ok {
+			return fmt.Errorf("unknown restart policy in COS eventlog: %s", string(cosTlv.EventContent))
+		}
+		cosState.Container.RestartPolicy = pb.RestartPolicy(restartPolicy)
+
+	case coscel.ImageIDType:
+		if cosState.Container.GetImageId() != "" {
+			return fmt.Errorf("found more than one ImageId event")
+		}
+		cosState.Container.ImageId = string(cosTlv.EventContent)
+
+	case coscel.EnvVarType:
+		envName, envVal, err := coscel.ParseEnvVar(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		cosState.Container.EnvVars[envName] = envVal
+
+	// Args are appended in log order; callers rely on this order matching
+	// the container command line.
+	case coscel.ArgType:
+		if opts.RejectNULArgs && bytes.IndexByte(cosTlv.EventContent, 0) != -1 {
+			return fmt.Errorf("found Arg event containing a NUL byte: %q", cosTlv.EventContent)
+		}
+		cosState.Container.Args = append(cosState.Container.Args, string(cosTlv.EventContent))
+
+	case coscel.OverrideArgType:
+		if opts.RejectNULArgs && bytes.IndexByte(cosTlv.EventContent, 0) != -1 {
+			return fmt.Errorf("found OverrideArg event containing a NUL byte: %q", cosTlv.EventContent)
+		}
+		cosState.Container.OverriddenArgs = append(cosState.Container.OverriddenArgs, string(cosTlv.EventContent))
 
-		case coscel.ImageDigestType:
-			if cosState.Container.GetImageDigest() != "" {
-				return nil, fmt.Errorf("found more than one ImageDigest event")
+	case coscel.OverrideEnvType:
+		envName, envVal, err := coscel.ParseEnvVar(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		cosState.Container.OverriddenEnvVars[envName] = envVal
+	case coscel.LaunchSeparatorType:
+		state.LaunchSeparatorPayload = string(cosTlv.EventContent)
+	case coscel.MemoryMonitorType:
+		enabled := decodeMemoryMonitor(cosTlv.EventContent)
+		cosState.HealthMonitoring.MemoryEnabled = &enabled
+	case coscel.GpuCCModeType:
+		if cosState.GpuDeviceState == nil {
+			cosState.GpuDeviceState = &pb.GpuDeviceState{}
+		}
+		ccMode, ok := pb.GPUDeviceCCMode_value[string(cosTlv.EventContent)]
+		if !ok {
+			return fmt.Errorf("unknown GPU device CC mode in COS eventlog: %s", string(cosTlv.EventContent))
+		}
+		cosState.GpuDeviceState.CcMode = pb.GPUDeviceCCMode(ccMode)
+	case coscel.GPUDeviceAttestationBindingType:
+		if opts.PopulateGpuDeviceState {
+			report, err := decodeGPUAttestationReport(cosTlv.EventContent)
+			if err != nil {
+				return err
 			}
-			cosState.Container.ImageDigest = string(cosTlv.EventContent)
+			cosState.GpuDeviceState.NvidiaAttestationReport = report
+		}
+	case coscel.LauncherVersionType:
+		if cosState.GetLauncherVersion() != nil {
+			return fmt.Errorf("found more than one LauncherVersion event")
+		}
+		launcherVersion, err := parseSemanticVersion(string(cosTlv.EventContent))
+		if err != nil {
+			return fmt.Errorf("invalid launcher version in COS eventlog: %v", err)
+		}
+		cosState.LauncherVersion = launcherVersion
+	case coscel.LaunchFailedType:
+		if state.LaunchFailed {
+			return fmt.Errorf("found more than one LaunchFailed event")
+		}
+		state.LaunchFailed = true
+		state.LaunchError = string(cosTlv.EventContent)
+		if !opts.AllowLaunchFailure {
+			return fmt.Errorf("found LaunchFailed event in COS eventlog: %s", string(cosTlv.EventContent))
+		}
+	case coscel.PrivilegedType:
+		if containerExt.Privileged != nil {
+			return fmt.Errorf("found more than one Privileged event")
+		}
+		privileged, err := parseBoolContent(cosTlv.EventContent)
+		if err != nil {
+			return fmt.Errorf("invalid Privileged event: %v", err)
+		}
+		containerExt.Privileged = &privileged
+	case coscel.ReadOnlyRootfsType:
+		if containerExt.ReadOnlyRootfs != nil {
+			return fmt.Errorf("found more than one ReadOnlyRootfs event")
+		}
+		readOnly, err := parseBoolContent(cosTlv.EventContent)
+		if err != nil {
+			return fmt.Errorf("invalid ReadOnlyRootfs event: %v", err)
+		}
+		containerExt.ReadOnlyRootfs = &readOnly
+	case coscel.CapabilityType:
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty Capability event")
+		}
+		containerExt.Capabilities = append(containerExt.Capabilities, string(cosTlv.EventContent))
+	case coscel.TeeTechnologyType:
+		if state.TeeTechnology != pb.GCEConfidentialTechnology_NONE {
+			return fmt.Errorf("found more than one TeeTechnology event")
+		}
+		// NONE is not a recordable value, so that it cannot mask a duplicate.
+		teeTechnology, ok := pb.GCEConfidentialTechnology_value[string(cosTlv.EventContent)]
+		if !ok || teeTechnology == int32(pb.GCEConfidentialTechnology_NONE) {
+			return fmt.Errorf("unknown TEE technology in COS eventlog: %s", string(cosTlv.EventContent))
+		}
+		state.TeeTechnology = pb.GCEConfidentialTechnology(teeTechnology)
+	case coscel.DNSServerType:
+		server, err := netip.ParseAddr(string(cosTlv.EventContent))
+		if err != nil {
+			return fmt.Errorf("invalid DNS server in COS eventlog: %v", err)
+		}
+		if slices.Contains(containerExt.DNS.Servers, server.String()) {
+			return fmt.Errorf("found duplicate DNSServer event: %s", server)
+		}
+		containerExt.DNS.Servers = append(containerExt.DNS.Servers, server.String())
+	case coscel.DNSSearchDomainType:
+		domain := string(cosTlv.EventContent)
+		if domain == "" {
+			return fmt.Errorf("found empty DNSSearchDomain event")
+		}
+		if slices.Contains(containerExt.DNS.SearchDomains, domain) {
+			return fmt.Errorf("found duplicate DNSSearchDomain event: %s", domain)
+		}
+		containerExt.DNS.SearchDomains = append(containerExt.DNS.SearchDomains, domain)
+	case coscel.MountType:
+		mount, err := parseMount(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		containerExt.Mounts = append(containerExt.Mounts, mount)
+	case coscel.PlatformType:
+		if containerExt.Platform != nil {
+			return fmt.Errorf("found more than one Platform event")
+		}
+		platform, err := parsePlatform(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		containerExt.Platform = &platform
+	case coscel.PlatformMismatchType:
+		if containerExt.HostPlatform != nil {
+			return fmt.Errorf("found more than one PlatformMismatch event")
+		}
+		platform, err := parsePlatform(string(cosTlv.EventContent))
+		if err != nil {
+			return fmt.Errorf("invalid PlatformMismatch event: %v", err)
+		}
+		containerExt.HostPlatform = &platform
+	case coscel.PullCredentialSourceType:
+		if containerExt.PullCredentialSource != "" {
+			return fmt.Errorf("found more than one PullCredentialSource event")
+		}
+		source := CredentialSource(cosTlv.EventContent)
+		switch source {
+		case CredentialSourceAnonymous, CredentialSourceServiceAccount, CredentialSourceWorkloadIdentity, CredentialSourceKey:
+		default:
+			return fmt.Errorf("unknown PullCredentialSource event [%s]", cosTlv.EventContent)
+		}
+		containerExt.PullCredentialSource = source
+	case coscel.SeccompProfileType:
+		if containerExt.SeccompProfile != "" {
+			return fmt.Errorf("found more than one SeccompProfile event")
+		}
+		profile := string(cosTlv.EventContent)
+		name, named := strings.CutPrefix(profile, "localhost/")
+		if profile != SeccompProfileDefault && profile != SeccompProfileUnconfined && (!named || name == "") {
+			return fmt.Errorf("malformed SeccompProfile event [%s], want %q, %q or localhost/<name>", profile, SeccompProfileDefault, SeccompProfileUnconfined)
+		}
+		containerExt.SeccompProfile = profile
+	case coscel.SbomReferenceType:
+		if containerExt.SbomReference != "" {
+			return fmt.Errorf("found more than one SbomReference event")
+		}
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty SbomReference event")
+		}
+		containerExt.SbomReference = string(cosTlv.EventContent)
+	case coscel.NetworkModeType:
+		if containerExt.NetworkMode != "" {
+			return fmt.Errorf("found more than one NetworkMode event")
+		}
+		mode := string(cosTlv.EventContent)
+		if mode != NetworkModeHost && mode != NetworkModeBridge && mode != NetworkModeNone {
+			return fmt.Errorf("unknown NetworkMode event [%s]", mode)
+		}
+		containerExt.NetworkMode = mode
+	case coscel.AcceleratorType:
+		accelerator, err := parseAccelerator(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		for _, attached := range containerExt.Accelerators {
+			if attached.Type == accelerator.Type {
+				return fmt.Errorf("found duplicate Accelerator event for type %s", accelerator.Type)
+			}
+		}
+		containerExt.Accelerators = append(containerExt.Accelerators, accelerator)
+	case coscel.ProvenanceReferenceType:
+		if containerExt.ProvenanceReference != "" {
+			return fmt.Errorf("found more than one ProvenanceReference event")
+		}
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty ProvenanceReference event")
+		}
+		containerExt.ProvenanceReference = string(cosTlv.EventContent)
+	case coscel.LifecycleHookType:
+		hook, err := parseLifecycleHook(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		for _, configured := range containerExt.LifecycleHooks {
+			if configured.Kind == hook.Kind {
+				return fmt.Errorf("found more than one LifecycleHook event for %s", hook.Kind)
+			}
+		}
+		containerExt.LifecycleHooks = append(containerExt.LifecycleHooks, hook)
+	case coscel.LayerDigestType:
+		if !digestRegexp.Match(cosTlv.EventContent) {
+			return fmt.Errorf("malformed LayerDigest event [%s], want <algorithm>:<encoded>", cosTlv.EventContent)
+		}
+		containerExt.LayerDigests = append(containerExt.LayerDigests, string(cosTlv.EventContent))
+	case coscel.UlimitType:
+		ulimit, err := parseUlimit(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		for _, set := range containerExt.Ulimits {
+			if set.Name == ulimit.Name {
+				return fmt.Errorf("found more than one Ulimit event for %s", ulimit.Name)
+			}
+		}
+		containerExt.Ulimits = append(containerExt.Ulimits, ulimit)
+	case coscel.SourceRevisionType:
+		if containerExt.SourceRevision != "" {
+			return fmt.Errorf("found more than one SourceRevision event")
+		}
+		if !sourceRevisionRegexp.Match(cosTlv.EventContent) {
+			return fmt.Errorf("malformed SourceRevision event [%s], want a hex git commit", cosTlv.EventContent)
+		}
+		containerExt.SourceRevision = string(cosTlv.EventContent)
+	case coscel.NamespaceSharingType:
+		namespace, mode, ok := strings.Cut(string(cosTlv.EventContent), "=")
+		if !ok || (mode != NamespaceModeHost && mode != NamespaceModePrivate) {
+			return fmt.Errorf("malformed NamespaceSharing event [%s], want <pid|ipc>=<host|private>", cosTlv.EventContent)
+		}
+		var sharing *string
+		switch namespace {
+		case "pid":
+			sharing = &containerExt.NamespaceSharing.PID
+		case "ipc":
+			sharing = &containerExt.NamespaceSharing.IPC
+		default:
+			return fmt.Errorf("malformed NamespaceSharing event [%s], unknown namespace %q", cosTlv.EventContent, namespace)
+		}
+		if *sharing != "" {
+			return fmt.Errorf("found more than one NamespaceSharing event for the %s namespace", namespace)
+		}
+		*sharing = mode
+	case coscel.RunAsUserType:
+		if containerExt.RunAsUser != "" {
+			return fmt.Errorf("found more than one RunAsUser event")
+		}
+		user, _, _ := strings.Cut(string(cosTlv.EventContent), ":")
+		if user == "" {
+			return fmt.Errorf("malformed RunAsUser event [%s], want <user>[:<group>]", cosTlv.EventContent)
+		}
+		if uid, err := strconv.ParseUint(user, 10, 32); err == nil {
+			uid32 := uint32(uid)
+			containerExt.RunAsUID = &uid32
+		}
+		containerExt.RunAsUser = string(cosTlv.EventContent)
+	case coscel.ImageCreatedType:
+		if !containerExt.ImageCreated.IsZero() {
+			return fmt.Errorf("found more than one ImageCreated event")
+		}
+		created, err := time.Parse(time.RFC3339, string(cosTlv.EventContent))
+		if err != nil {
+			return fmt.Errorf("malformed ImageCreated event, want an RFC 3339 timestamp: %v", err)
+		}
+		// The zero time is not a recordable value, so that it cannot mask a
+		// duplicate.
+		if created.IsZero() {
+			return fmt.Errorf("malformed ImageCreated event, found the zero time")
+		}
+		containerExt.ImageCreated = created
+	case coscel.ProbeConfigType:
+		probe, err := parseProbeConfig(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(containerExt.Probes, func(p ProbeConfig) bool { return p.Kind == probe.Kind }) {
+			return fmt.Errorf("found more than one %s ProbeConfig event", probe.Kind)
+		}
+		containerExt.Probes = append(containerExt.Probes, probe)
+	case coscel.TerminationGracePeriodType:
+		if containerExt.TerminationGracePeriod != nil {
+			return fmt.Errorf("found more than one TerminationGracePeriod event")
+		}
+		seconds, err := strconv.ParseUint(string(cosTlv.EventContent), 10, 32)
+		if err != nil {
+			return fmt.Errorf("malformed TerminationGracePeriod event [%s], want a number of seconds: %v", cosTlv.EventContent, err)
+		}
+		gracePeriod := time.Duration(seconds) * time.Second
+		containerExt.TerminationGracePeriod = &gracePeriod
+	case coscel.RestartCountType:
+		if containerExt.RestartCount != nil {
+			return fmt.Errorf("found more than one RestartCount event")
+		}
+		count, err := strconv.ParseUint(string(cosTlv.EventContent), 10, 32)
+		if err != nil {
+			return fmt.Errorf("malformed RestartCount event [%s]: %v", cosTlv.EventContent, err)
+		}
+		restartCount := uint32(count)
+		containerExt.RestartCount = &restartCount
+	case coscel.KernelCmdlineType:
+		if state.BootState.KernelCmdline != "" {
+			return fmt.Errorf("found more than one KernelCmdline event")
+		}
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty KernelCmdline event")
+		}
+		state.BootState.KernelCmdline = string(cosTlv.EventContent)
+	case coscel.SignerType:
+		signer := string(cosTlv.EventContent)
+		if signer == "" {
+			return fmt.Errorf("found empty Signer event")
+		}
+		if slices.Contains(containerExt.Signers, signer) {
+			return fmt.Errorf("found duplicate Signer event: %s", signer)
+		}
+		containerExt.Signers = append(containerExt.Signers, signer)
+	case coscel.LoggingConfigType:
+		if containerExt.LoggingConfig != nil {
+			return fmt.Errorf("found more than one LoggingConfig event")
+		}
+		config, err := parseLoggingConfig(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		containerExt.LoggingConfig = &config
+	case coscel.VulnerabilityScanType:
+		if containerExt.VulnerabilityScan != nil {
+			return fmt.Errorf("found more than one VulnerabilityScan event")
+		}
+		scan, err := parseVulnerabilityScan(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		containerExt.VulnerabilityScan = &scan
+	case coscel.SealingPolicyType:
+		if state.SealingPolicy != "" {
+			return fmt.Errorf("found more than one SealingPolicy event")
+		}
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty SealingPolicy event")
+		}
+		state.SealingPolicy = string(cosTlv.EventContent)
+	case coscel.LaunchPolicyType:
+		if state.LaunchPolicy != nil {
+			return fmt.Errorf("found more than one LaunchPolicy event")
+		}
+		policy, err := parseLaunchPolicy(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		state.LaunchPolicy = &policy
+	case coscel.NonceType:
+		if state.Nonce != nil {
+			return fmt.Errorf("found more than one Nonce event")
+		}
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty Nonce event")
+		}
+		state.Nonce = bytes.Clone(cosTlv.EventContent)
+	case coscel.GrantedResourceType:
+		resource := string(cosTlv.EventContent)
+		if resource == "" {
+			return fmt.Errorf("found empty GrantedResource event")
+		}
+		if slices.Contains(state.GrantedResources, resource) {
+			return fmt.Errorf("found duplicate GrantedResource event: %s", resource)
+		}
+		state.GrantedResources = append(state.GrantedResources, resource)
+	case coscel.ExperimentalFeatureType:
+		feature := string(cosTlv.EventContent)
+		if feature == "" {
+			return fmt.Errorf("found empty ExperimentalFeature event")
+		}
+		if slices.Contains(state.ExperimentalFeatures, feature) {
+			return fmt.Errorf("found duplicate ExperimentalFeature event: %s", feature)
+		}
+		state.ExperimentalFeatures = append(state.ExperimentalFeatures, feature)
+	case coscel.TokenAudienceType:
+		if len(cosTlv.EventContent) == 0 {
+			return fmt.Errorf("found empty TokenAudience event")
+		}
+		if state.TokenAudiences == nil {
+			state.TokenAudiences = make(map[string]struct{})
+		}
+		state.TokenAudiences[string(cosTlv.EventContent)] = struct{}{}
+	case coscel.ConfigHashType:
+		if state.ConfigHash != "" {
+			return fmt.Errorf("found more than one ConfigHash event")
+		}
+		if !digestRegexp.Match(cosTlv.EventContent) {
+			return fmt.Errorf("malformed ConfigHash event [%s], want <algorithm>:<encoded>", cosTlv.EventContent)
+		}
+		state.ConfigHash = string(cosTlv.EventContent)
+	case coscel.InstanceMetadataType:
+		if state.InstanceMetadata != nil {
+			return fmt.Errorf("found more than one InstanceMetadata event")
+		}
+		metadata, err := parseInstanceMetadata(string(cosTlv.EventContent))
+		if err != nil {
+			return err
+		}
+		state.InstanceMetadata = &metadata
 
-		case coscel.RestartPolicyType:
-			restartPolicy, ok := pb.RestartPolicy_value[string(cosTlv.EventContent)]
-			if !ok {
-				return nil, fmt.Errorf("unknown restart policy in COS eventlog: %s", string(cosTlv.EventContent))
+	default:
+		handler, ok := opts.EventHandlers[cosTlv.EventType]
+		if !ok {
+			return fmt.Errorf("found unknown COS Event Type %v", cosTlv.EventType)
+		}
+		if err := handler(state, cosTlv.EventContent); err != nil {
+			return fmt.Errorf("failed to handle COS Event Type %v: %v", cosTlv.EventType, err)
+		}
+	}
+	return nil
+}
+
+// checkCOSState applies the checks in opts which need the fully extracted
+// state.
+func checkCOSState(state *COSState, opts Options) error {
+	if opts.ValidateImageConsistency {
+		if err := ValidateImageConsistency(state.GetContainer()); err != nil {
+			return err
+		}
+	}
+	if opts.AllowedEnvNames != nil {
+		var disallowed []string
+		for _, envVars := range []map[string]string{state.GetContainer().GetEnvVars(), state.GetContainer().GetOverriddenEnvVars()} {
+			for name := range envVars {
+				if !slices.Contains(opts.AllowedEnvNames, name) {
+					disallowed = append(disallowed, name)
+				}
 			}
-			cosState.Container.RestartPolicy = pb.RestartPolicy(restartPolicy)
+		}
+		if len(disallowed) > 0 {
+			slices.Sort(disallowed)
+			return fmt.Errorf("found env vars not in the allowlist: %v", slices.Compact(disallowed))
+		}
+	}
+	if len(opts.ReservedEnvNames) > 0 {
+		var reserved []string
+		for _, envVars := range []map[string]string{state.GetContainer().GetEnvVars(), state.GetContainer().GetOverriddenEnvVars()} {
+			for name := range envVars {
+				if slices.Contains(opts.ReservedEnvNames, name) {
+					reserved = append(reserved, name)
+				}
+			}
+		}
+		if len(reserved) > 0 {
+			slices.Sort(reserved)
+			err := fmt.Errorf("found env vars with reserved names: %v", slices.Compact(reserved))
+			if !opts.WarnOnReservedEnvNames {
+				return err
+			}
+			state.Warnings = append(state.Warnings, err.Error())
+		}
+	}
+	if n := len(state.GetContainer().GetOverriddenArgs()); opts.MaxOverriddenArgs > 0 && n > opts.MaxOverriddenArgs {
+		return fmt.Errorf("found %d overridden args, exceeding the maximum of %d", n, opts.MaxOverriddenArgs)
+	}
+	if n := len(state.GetContainer().GetOverriddenEnvVars()); opts.MaxOverriddenEnvVars > 0 && n > opts.MaxOverriddenEnvVars {
+		return fmt.Errorf("found %d overridden env vars, exceeding the maximum of %d", n, opts.MaxOverriddenEnvVars)
+	}
+	if opts.MaxArgsCount > 0 || opts.MaxArgsBytes > 0 {
+		args := slices.Concat(state.GetContainer().GetArgs(), state.GetContainer().GetOverriddenArgs())
+		if opts.MaxArgsCount > 0 && len(args) > opts.MaxArgsCount {
+			return fmt.Errorf("found %d args, exceeding the maximum of %d", len(args), opts.MaxArgsCount)
+		}
+		argsBytes := 0
+		for _, arg := range args {
+			argsBytes += len(arg)
+		}
+		if opts.MaxArgsBytes > 0 && argsBytes > opts.MaxArgsBytes {
+			return fmt.Errorf("found %d bytes of args, exceeding the maximum of %d", argsBytes, opts.MaxArgsBytes)
+		}
+	}
+	return nil
+}
+
+// checkDistinctEnvVars adds the name set by an EnvVar or OverrideEnv event to
+// names and returns an error once there are more than
+// Options.MaxDistinctEnvVars.
+func (opts Options) checkDistinctEnvVars(names map[string]struct{}, cosTlv coscel.COSTLV) error {
+	if opts.MaxDistinctEnvVars <= 0 || (cosTlv.EventType != coscel.EnvVarType && cosTlv.EventType != coscel.OverrideEnvType) {
+		return nil
+	}
+	envName, _, err := coscel.ParseEnvVar(string(cosTlv.EventContent))
+	if err != nil {
+		// Left to applyCOSEvent to report.
+		return nil
+	}
+	names[envName] = struct{}{}
+	if len(names) > opts.MaxDistinctEnvVars {
+		return fmt.Errorf("found %d distinct env vars, exceeding the maximum of %d", len(names), opts.MaxDistinctEnvVars)
+	}
+	return nil
+}
 
-		case coscel.ImageIDType:
-			if cosState.Container.GetImageId() != "" {
-				return nil, fmt.Errorf("found more than one ImageId event")
+// verifyCOSRecord checks the record is measured into an expected register,
+// parses its COS content and verifies the content against the record digests.
+func verifyCOSRecord(record cel.Record, registerType uint8, opts Options) (coscel.COSTLV, error) {
+	cosTlv, err := parseCOSRecord(record, registerType, opts)
+	if err != nil {
+		return coscel.COSTLV{}, err
+	}
+	if err := verifyRecordDigests(cosTlv, record, opts); err != nil {
+		return coscel.COSTLV{}, err
+	}
+	return cosTlv, nil
+}
+
+// parseCOSRecord checks the record is measured into an expected register and
+// parses its COS content, without verifying the record digests.
+func parseCOSRecord(record cel.Record, registerType uint8, opts Options) (coscel.COSTLV, error) {
+	if uint8(record.IndexType) != registerType {
+		return coscel.COSTLV{}, fmt.Errorf("expect registerType: %d, but get %d in a CEL record", registerType, record.IndexType)
+	}
+
+	switch record.IndexType {
+	case cel.PCRType:
+		if !slices.Contains(opts.allowedIndices(cel.PCRType), record.Index) {
+			return coscel.COSTLV{}, fmt.Errorf("found unexpected PCR %d in COS CEL log", record.Index)
+		}
+	case cel.CCMRType:
+		if !slices.Contains(opts.allowedIndices(cel.CCMRType), record.Index) {
+			return coscel.COSTLV{}, fmt.Errorf("found unexpected CCELMR %d in COS CEL log", record.Index)
+		}
+	default:
+		custom, ok := opts.CustomRegisterTypes[record.IndexType]
+		if !ok {
+			return coscel.COSTLV{}, fmt.Errorf("unknown COS CEL log index type %d", record.IndexType)
+		}
+		if !slices.Contains(custom.AllowedIndices, record.Index) {
+			return coscel.COSTLV{}, fmt.Errorf("found unexpected %s %d in COS CEL log", custom.Name, record.Index)
+		}
+		if custom.ValidateRecord != nil {
+			if err := custom.ValidateRecord(record); err != nil {
+				return coscel.COSTLV{}, fmt.Errorf("CEL record %d failed %s validation: %w", record.RecNum, custom.Name, err)
 			}
-			cosState.Container.ImageId = string(cosTlv.EventContent)
+		}
+	}
 
-		case coscel.EnvVarType:
-			envName, envVal, err := coscel.ParseEnvVar(string(cosTlv.EventContent))
-			if err != nil {
-				return nil, err
+	// The Content.Type is not verified at this point, so we have to fail
+	// if we see any events that we do not understand. This ensures that
+	// we either verify the digest of event event in this PCR/RTMA, or we
+	// fail to replay the event log.
+	// TODO: See if we can fix this to have the Content Type be verified.
+	return coscel.ParseToCOSTLV(record.Content)
+}
+
+// skipNonCOSRecord reports whether record is ignored by
+// Options.SkipNonCOSRecords: its content is not a COS TLV and it is measured
+// outside the allowed COS indices of its register type.
+func (opts Options) skipNonCOSRecord(record cel.Record) bool {
+	if !opts.SkipNonCOSRecords || coscel.IsCOSTLV(record.Content) {
+		return false
+	}
+	return !slices.Contains(opts.allowedIndices(record.IndexType), record.Index)
+}
+
+// verifySkippedRecord checks a non-COS record skipped by
+// Options.SkipNonCOSRecords.
+func verifySkippedRecord(record cel.Record, registerType uint8, opts Options) error {
+	if uint8(record.IndexType) != registerType {
+		return fmt.Errorf("expect registerType: %d, but get %d in a CEL record", registerType, record.IndexType)
+	}
+	if !opts.VerifySkippedRecordDigests {
+		return nil
+	}
+	if len(record.Digests) == 0 {
+		return fmt.Errorf("CEL record %d has no digests", record.RecNum)
+	}
+	return opts.verifyDigests(record, tlvContent(record.Content), record.Digests)
+}
+
+// tlvContent is a cel.Content whose digest is computed over the encoded TLV.
+type tlvContent cel.TLV
+
+func (c tlvContent) TLV() (cel.TLV, error) {
+	return cel.TLV(c), nil
+}
+
+func (c tlvContent) GenerateDigest(hashAlgo crypto.Hash) ([]byte, error) {
+	b, err := cel.TLV(c).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	hash := hashAlgo.New()
+	if _, err = hash.Write(b); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// verifyRecordDigests verifies every digest bank of the record against the COS
+// content, and checks the record carries the digests required by opts.
+func verifyRecordDigests(cosTlv coscel.COSTLV, record cel.Record, opts Options) error {
+	// cel.VerifyDigests succeeds vacuously on an empty digest map.
+	if len(record.Digests) == 0 {
+		return fmt.Errorf("CEL record %d has no digests", record.RecNum)
+	}
+	for _, hash := range opts.RequiredDigestAlgs {
+		if _, ok := record.Digests[hash]; !ok {
+			return fmt.Errorf("CEL record %d is missing required %v digest", record.RecNum, hash)
+		}
+	}
+	digests := record.Digests
+	if len(opts.VerifyDigestAlgs) > 0 {
+		digests = make(map[crypto.Hash][]byte, len(opts.VerifyDigestAlgs))
+		for _, hash := range opts.VerifyDigestAlgs {
+			digest, ok := record.Digests[hash]
+			if !ok {
+				return fmt.Errorf("CEL record %d is missing %v digest to verify", record.RecNum, hash)
 			}
-			cosState.Container.EnvVars[envName] = envVal
+			digests[hash] = digest
+		}
+	}
+	return opts.verifyDigests(record, cosTlv, digests)
+}
 
-		case coscel.ArgType:
-			cosState.Container.Args = append(cosState.Container.Args, string(cosTlv.EventContent))
+// verifyDigests verifies the digests of the record's content with
+// Options.DigestVerifier, or cel.VerifyDigests if unset.
+func (opts Options) verifyDigests(record cel.Record, content cel.Content, digests map[crypto.Hash][]byte) error {
+	if opts.DigestVerifier != nil {
+		return opts.DigestVerifier(record, content, digests)
+	}
+	return cel.VerifyDigests(content, digests)
+}
 
-		case coscel.OverrideArgType:
-			cosState.Container.OverriddenArgs = append(cosState.Container.OverriddenArgs, string(cosTlv.EventContent))
+// lookupRestartPolicy returns the pb.RestartPolicy value named by policy. If
+// normalize is set, surrounding whitespace and case differences are ignored.
+func lookupRestartPolicy(policy string, normalize bool) (int32, bool) {
+	if value, ok := pb.RestartPolicy_value[policy]; ok || !normalize {
+		return value, ok
+	}
+	policy = strings.TrimSpace(policy)
+	for name, value := range pb.RestartPolicy_value {
+		if strings.EqualFold(name, policy) {
+			return value, true
+		}
+	}
+	return 0, false
+}
 
-		case coscel.OverrideEnvType:
-			envName, envVal, err := coscel.ParseEnvVar(string(cosTlv.EventContent))
-			if err != nil {
-				return nil, err
+// parseProbeConfig parses a probe of the form
+// "kind=<kind>,type=<type>,target=<target>[,period=<duration>][,timeout=<duration>]".
+func parseProbeConfig(probe string) (ProbeConfig, error) {
+	var p ProbeConfig
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(probe, ",") {
+		key, value, hasValue := strings.Cut(field, "=")
+		if !hasValue {
+			return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], unexpected field %q", probe, field)
+		}
+		if seen[key] {
+			return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], duplicate field %q", probe, key)
+		}
+		seen[key] = true
+		switch key {
+		case "kind":
+			if value != "liveness" && value != "readiness" && value != "startup" {
+				return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], unknown kind %q", probe, value)
 			}
-			cosState.Container.OverriddenEnvVars[envName] = envVal
-		case coscel.LaunchSeparatorType:
-			seenSeparator = true
-		case coscel.MemoryMonitorType:
-			enabled := false
-			if len(cosTlv.EventContent) == 1 && cosTlv.EventContent[0] == uint8(1) {
-				enabled = true
+			p.Kind = value
+		case "type":
+			if value != "http" && value != "tcp" && value != "exec" {
+				return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], unknown type %q", probe, value)
 			}
-			cosState.HealthMonitoring.MemoryEnabled = &enabled
-		case coscel.GpuCCModeType:
-			if cosState.GpuDeviceState == nil {
-				cosState.GpuDeviceState = &pb.GpuDeviceState{}
+			p.Type = value
+		case "target":
+			p.Target = value
+		case "period", "timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], %s must be a positive duration", probe, key)
 			}
-			ccMode, ok := pb.GPUDeviceCCMode_value[string(cosTlv.EventContent)]
-			if !ok {
-				return nil, fmt.Errorf("unknown GPU device CC mode in COS eventlog: %s", string(cosTlv.EventContent))
-			}
-			cosState.GpuDeviceState.CcMode = pb.GPUDeviceCCMode(ccMode)
-		case coscel.GPUDeviceAttestationBindingType:
-			if opts.PopulateGpuDeviceState {
-				report := &attestpb.NvidiaAttestationReport{}
-				if err := proto.Unmarshal(cosTlv.EventContent, report); err != nil {
-					return nil, fmt.Errorf("failed to unmarshal GPU attestation report: %v", err)
-				}
-				cosState.GpuDeviceState.NvidiaAttestationReport = report
+			if key == "period" {
+				p.Period = d
+			} else {
+				p.Timeout = d
 			}
+		default:
+			return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], unexpected field %q", probe, field)
+		}
+	}
+	if p.Kind == "" || p.Type == "" || p.Target == "" {
+		return ProbeConfig{}, fmt.Errorf("malformed probe config [%s], kind, type and target are required", probe)
+	}
+	return p, nil
+}
+
+// parseMount parses a mount of the form
+// "type=<type>,source=<source>,target=<target>[,readonly]", where source is
+// omitted for tmpfs mounts.
+func parseMount(mount string) (Mount, error) {
+	var m Mount
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(mount, ",") {
+		key, value, hasValue := strings.Cut(field, "=")
+		if seen[key] {
+			return Mount{}, fmt.Errorf("malformed mount [%s], duplicate field %q", mount, key)
+		}
+		seen[key] = true
+		switch {
+		case key == "type" && hasValue:
+			m.Type = value
+		case key == "source" && hasValue:
+			m.Source = value
+		case key == "target" && hasValue:
+			m.Target = value
+		case key == "readonly" && !hasValue:
+			m.ReadOnly = true
+		default:
+			return Mount{}, fmt.Errorf("malformed mount [%s], unexpected field %q", mount, field)
+		}
+	}
+	if m.Type == "" || m.Target == "" {
+		return Mount{}, fmt.Errorf("malformed mount [%s], type and target are required", mount)
+	}
+	if m.Source == "" && m.Type != "tmpfs" {
+		return Mount{}, fmt.Errorf("malformed mount [%s], source is required for %s mounts", mount, m.Type)
+	}
+	return m, nil
+}
+
+// platformComponentRegexp matches a single component of a platform string.
+var platformComponentRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// parsePlatform parses a platform of the form os/arch[/variant].
+func parsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("malformed platform [%s], want os/arch[/variant]", platform)
+	}
+	for _, part := range parts {
+		if !platformComponentRegexp.MatchString(part) {
+			return Platform{}, fmt.Errorf("malformed platform [%s], invalid component %q", platform, part)
+		}
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
 
+// parseLoggingConfig parses a logging configuration of the form "disabled" or
+// a comma-separated list of the "cloud_logging" and "serial" destinations.
+func parseLoggingConfig(config string) (LoggingConfig, error) {
+	if config == "disabled" {
+		return LoggingConfig{}, nil
+	}
+	var c LoggingConfig
+	for _, destination := range strings.Split(config, ",") {
+		var enabled *bool
+		switch destination {
+		case "cloud_logging":
+			enabled = &c.CloudLogging
+		case "serial":
+			enabled = &c.Serial
 		default:
-			return nil, fmt.Errorf("found unknown COS Event Type %v", cosTlv.EventType)
+			return LoggingConfig{}, fmt.Errorf("malformed LoggingConfig event [%s], want \"disabled\" or a list of \"cloud_logging\" and \"serial\"", config)
+		}
+		if *enabled {
+			return LoggingConfig{}, fmt.Errorf("malformed LoggingConfig event [%s], duplicate destination %q", config, destination)
+		}
+		*enabled = true
+	}
+	return c, nil
+}
+
+// parseVulnerabilityScan parses a scan result of the form
+// "<clean|flagged>:<attestation>".
+func parseVulnerabilityScan(scan string) (VulnerabilityScan, error) {
+	result, attestation, ok := strings.Cut(scan, ":")
+	if !ok || attestation == "" {
+		return VulnerabilityScan{}, fmt.Errorf("malformed VulnerabilityScan event [%s], want <clean|flagged>:<attestation>", scan)
+	}
+	switch result {
+	case "clean":
+		return VulnerabilityScan{Clean: true, Attestation: attestation}, nil
+	case "flagged":
+		return VulnerabilityScan{Attestation: attestation}, nil
+	default:
+		return VulnerabilityScan{}, fmt.Errorf("malformed VulnerabilityScan event [%s], unknown result %q", scan, result)
+	}
+}
+
+// parseInstanceMetadata parses an instance identity of the form
+// "projects/<project>/zones/<zone>/instances/<instance ID>".
+func parseInstanceMetadata(metadata string) (InstanceMetadata, error) {
+	parts := strings.Split(metadata, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "zones" || parts[4] != "instances" || parts[1] == "" || parts[3] == "" {
+		return InstanceMetadata{}, fmt.Errorf("malformed InstanceMetadata event [%s], want projects/<project>/zones/<zone>/instances/<instance ID>", metadata)
+	}
+	instanceID, err := strconv.ParseUint(parts[5], 10, 64)
+	if err != nil {
+		return InstanceMetadata{}, fmt.Errorf("malformed InstanceMetadata event [%s], invalid instance ID: %v", metadata, err)
+	}
+	return InstanceMetadata{ProjectID: parts[1], Zone: parts[3], InstanceID: instanceID}, nil
+}
+
+// parseAccelerator parses an accelerator attachment of the form
+// "<type>=<count>".
+func parseAccelerator(accelerator string) (Accelerator, error) {
+	deviceType, count, ok := strings.Cut(accelerator, "=")
+	if !ok || deviceType == "" {
+		return Accelerator{}, fmt.Errorf("malformed Accelerator event [%s], want <type>=<count>", accelerator)
+	}
+	n, err := strconv.ParseUint(count, 10, 32)
+	if err != nil || n == 0 {
+		return Accelerator{}, fmt.Errorf("malformed Accelerator event [%s], want a positive device count", accelerator)
+	}
+	return Accelerator{Type: deviceType, Count: uint32(n)}, nil
+}
+
+// parseLifecycleHook parses a lifecycle hook of the form "<kind>=<command>".
+func parseLifecycleHook(hook string) (LifecycleHook, error) {
+	kind, command, ok := strings.Cut(hook, "=")
+	if !ok || command == "" {
+		return LifecycleHook{}, fmt.Errorf("malformed LifecycleHook event [%s], want <kind>=<command>", hook)
+	}
+	if kind != "poststart" && kind != "prestop" {
+		return LifecycleHook{}, fmt.Errorf("malformed LifecycleHook event [%s], unknown kind %q", hook, kind)
+	}
+	return LifecycleHook{Kind: kind, Command: command}, nil
+}
+
+// sourceRevisionRegexp matches a full SHA-1 or SHA-256 git object name.
+var sourceRevisionRegexp = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// ulimitNameRegexp matches a ulimit name, e.g. nofile or memlock.
+var ulimitNameRegexp = regexp.MustCompile(`^[a-z]+$`)
+
+// parseUlimit parses a ulimit of the form "<name>=<soft>[:<hard>]", as taken
+// by docker run --ulimit. The hard limit defaults to the soft limit.
+func parseUlimit(ulimit string) (Ulimit, error) {
+	name, limits, ok := strings.Cut(ulimit, "=")
+	if !ok || !ulimitNameRegexp.MatchString(name) {
+		return Ulimit{}, fmt.Errorf("malformed Ulimit event [%s], want <name>=<soft>[:<hard>]", ulimit)
+	}
+	softLimit, hardLimit, hasHard := strings.Cut(limits, ":")
+	soft, err := strconv.ParseUint(softLimit, 10, 64)
+	if err != nil {
+		return Ulimit{}, fmt.Errorf("malformed Ulimit event [%s], invalid soft limit: %v", ulimit, err)
+	}
+	hard := soft
+	if hasHard {
+		if hard, err = strconv.ParseUint(hardLimit, 10, 64); err != nil {
+			return Ulimit{}, fmt.Errorf("malformed Ulimit event [%s], invalid hard limit: %v", ulimit, err)
 		}
+	}
+	if soft > hard {
+		return Ulimit{}, fmt.Errorf("malformed Ulimit event [%s], soft limit exceeds the hard limit", ulimit)
+	}
+	return Ulimit{Name: name, Soft: soft, Hard: hard}, nil
+}
 
+// parseSemanticVersion parses a version of the form "major.minor.patch".
+func parseSemanticVersion(version string) (*pb.SemanticVersion, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed semantic version [%s], want major.minor.patch", version)
+	}
+	var nums [3]uint32
+	for i, part := range parts {
+		num, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed semantic version [%s]: %v", version, err)
+		}
+		nums[i] = uint32(num)
 	}
-	return cosState, nil
+	return &pb.SemanticVersion{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
 }
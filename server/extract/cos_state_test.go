@@ -3,9 +3,15 @@ package extract
 import (
 	"bytes"
 	"crypto"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"math/rand"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
 	attestpb "github.com/GoogleCloudPlatform/confidential-space/server/proto/gen/attestation"
@@ -336,6 +342,13 @@ func TestParsingRTMREventlog(t *testing.T) {
 	if _, err = ParseCOSCEL(buf.Bytes(), hackedPCRBank, Options{}); err == nil {
 		t.Errorf("expecting error from ParseCOSCEL() when using RTMR CEL Log, but get nil")
 	}
+
+	// The record limit is enforced before the log is replayed.
+	for _, bank := range []register.MRBank{rtmrBank, hackedPCRBank} {
+		if _, err = ParseCOSCEL(buf.Bytes(), bank, Options{MaxRecords: 1}); err == nil || !strings.Contains(err.Error(), "exceeding the maximum") {
+			t.Errorf("ParseCOSCEL() over the record limit returned error %v, want record limit error", err)
+		}
+	}
 }
 
 func TestParsingCELEventLog(t *testing.T) {
@@ -567,3 +580,2450 @@ func extendDigestToPCR(tpm io.ReadWriter, algo crypto.Hash, mrIndex int, digest
 	}
 	return tpm2.PCRExtend(tpm, tpmutil.Handle(mrIndex), tpm2Algo, digest, "")
 }
+
+// buildCEL appends the COS events to a new CEL of the given register type,
+// measured into mrIndex using SHA384. The register itself is not extended, so
+// the CEL is only suitable for tests that do not replay.
+func buildCEL(t *testing.T, registerType cel.MRType, mrIndex int, events []coscel.COSTLV) cel.CEL {
+	t.Helper()
+	return buildCELWithHashes(t, registerType, mrIndex, []crypto.Hash{crypto.SHA384}, events)
+}
+
+// buildCELWithHashes is like buildCEL, but measures each event with the given
+// digest algorithms.
+func buildCELWithHashes(t *testing.T, registerType cel.MRType, mrIndex int, hashes []crypto.Hash, events []coscel.COSTLV) cel.CEL {
+	t.Helper()
+	var eventLog cel.CEL
+	if registerType == cel.PCRType {
+		eventLog = cel.NewPCR()
+	} else {
+		eventLog = cel.NewConfComputeMR()
+	}
+	noopExtender := func(crypto.Hash, int, []byte) error { return nil }
+	for _, event := range events {
+		if err := eventLog.AppendEvent(event, hashes, mrIndex, noopExtender); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return eventLog
+}
+
+func TestVerifiedCOSStateAllowedIndices(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+	}
+	testCases := []struct {
+		name         string
+		registerType cel.MRType
+		mrIndex      int
+		opts         Options
+		wantErr      bool
+	}{
+		{"default PCR index", cel.PCRType, coscel.EventPCRIndex, Options{}, false},
+		{"default CCMR index", cel.CCMRType, coscel.COSCCELMRIndex, Options{}, false},
+		{"non-default PCR index without override", cel.PCRType, 14, Options{}, true},
+		{"non-default CCMR index without override", cel.CCMRType, 3, Options{}, true},
+		{"overridden PCR index", cel.PCRType, 14, Options{AllowedPCRIndices: []uint8{14}}, false},
+		{"overridden CCMR index", cel.CCMRType, 3, Options{AllowedCCMRIndices: []uint8{3}}, false},
+		{"override excludes default PCR index", cel.PCRType, coscel.EventPCRIndex, Options{AllowedPCRIndices: []uint8{14}}, true},
+		{"PCR override does not apply to CCMR", cel.CCMRType, 3, Options{AllowedPCRIndices: []uint8{3}}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, tc.registerType, tc.mrIndex, events)
+			cosState, err := VerifiedCOSState(eventLog, uint8(tc.registerType), tc.opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("VerifiedCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && cosState.GetContainer().GetImageReference() != string(events[0].EventContent) {
+				t.Errorf("VerifiedCOSState() got image reference %q, want %q", cosState.GetContainer().GetImageReference(), events[0].EventContent)
+			}
+		})
+	}
+}
+
+func TestVerifiedCOSStateLauncherVersion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		versions []string
+		want     *attestationpb.SemanticVersion
+		wantErr  bool
+	}{
+		{"no version", nil, nil, false},
+		{"valid version", []string{"1.2.3"}, &attestationpb.SemanticVersion{Major: 1, Minor: 2, Patch: 3}, false},
+		{"zero version", []string{"0.0.0"}, &attestationpb.SemanticVersion{}, false},
+		{"duplicate version", []string{"1.2.3", "1.2.3"}, nil, true},
+		{"missing patch", []string{"1.2"}, nil, true},
+		{"non-numeric", []string{"1.2.x"}, nil, true},
+		{"negative", []string{"1.-2.3"}, nil, true},
+		{"empty", []string{""}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, version := range tc.versions {
+				events = append(events, coscel.COSTLV{EventType: coscel.LauncherVersionType, EventContent: []byte(version)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			cosState, err := VerifiedCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("VerifiedCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cosState.GetLauncherVersion(), tc.want, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected launcher version diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateRawContents(t *testing.T) {
+	_, gpuEvidenceBytes := testGpuReport(t)
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.ArgType, EventContent: []byte("")},
+		{EventType: coscel.ArgType, EventContent: []byte("--y")},
+		{EventType: coscel.MemoryMonitorType, EventContent: []byte{1}},
+		{EventType: coscel.GPUDeviceAttestationBindingType, EventContent: gpuEvidenceBytes},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{PopulateRawContents: true})
+	if err != nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+
+	// The raw contents must match the content of each record in the log.
+	wantRawContents := make(map[coscel.ContentType][][]byte)
+	for _, record := range eventLog.Records() {
+		cosTlv, err := coscel.ParseToCOSTLV(record.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantRawContents[cosTlv.EventType] = append(wantRawContents[cosTlv.EventType], cosTlv.EventContent)
+	}
+	if diff := cmp.Diff(state.RawContents, wantRawContents); diff != "" {
+		t.Errorf("unexpected raw contents diff: \n%v", diff)
+	}
+	if diff := cmp.Diff(state.GetContainer().GetArgs(), []string{"--x", "", "--y"}); diff != "" {
+		t.Errorf("unexpected args diff: \n%v", diff)
+	}
+
+	state, err = ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+	if err != nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+	if state.RawContents != nil {
+		t.Errorf("ExtractCOSState() without PopulateRawContents got raw contents %v, want nil", state.RawContents)
+	}
+}
+
+func TestVerifiedCOSStateDigestBanks(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	}
+	singleBank := []crypto.Hash{crypto.SHA384}
+	multiBank := []crypto.Hash{crypto.SHA256, crypto.SHA384}
+
+	testCases := []struct {
+		name     string
+		hashes   []crypto.Hash
+		required []crypto.Hash
+		tamper   crypto.Hash
+		wantErr  bool
+	}{
+		{name: "single bank", hashes: singleBank},
+		{name: "multi bank", hashes: multiBank},
+		{name: "single bank with required bank", hashes: singleBank, required: []crypto.Hash{crypto.SHA384}},
+		{name: "multi bank with required banks", hashes: multiBank, required: multiBank},
+		{name: "single bank missing required bank", hashes: singleBank, required: []crypto.Hash{crypto.SHA256}, wantErr: true},
+		{name: "single bank tampered", hashes: singleBank, tamper: crypto.SHA384, wantErr: true},
+		{name: "multi bank with first bank tampered", hashes: multiBank, tamper: crypto.SHA256, wantErr: true},
+		{name: "multi bank with second bank tampered", hashes: multiBank, tamper: crypto.SHA384, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCELWithHashes(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.hashes, events)
+			if tc.tamper != 0 {
+				eventLog.Records()[1].Digests[tc.tamper][0] ^= 0xff
+			}
+			_, err := VerifiedCOSState(eventLog, uint8(cel.CCMRType), Options{RequiredDigestAlgs: tc.required})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("VerifiedCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifiedCOSStateNoDigests(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+	})
+	record := eventLog.Records()[0]
+	for hash := range record.Digests {
+		delete(record.Digests, hash)
+	}
+	if _, err := VerifiedCOSState(eventLog, uint8(cel.CCMRType), Options{}); err == nil {
+		t.Errorf("VerifiedCOSState() with a record without digests returned nil error, want error")
+	}
+}
+
+func TestExtractPhase(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/first:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--first")},
+		{EventType: coscel.LaunchSeparatorType},
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/second:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--second")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	testCases := []struct {
+		phase   int
+		want    *attestationpb.ContainerState
+		wantErr bool
+	}{
+		{phase: 0, want: &attestationpb.ContainerState{ImageReference: "docker.io/library/first:latest", Args: []string{"--first"}}},
+		{phase: 1, want: &attestationpb.ContainerState{ImageReference: "docker.io/library/second:latest", Args: []string{"--second"}}},
+		{phase: 2, wantErr: true},
+		{phase: -1, wantErr: true},
+	}
+	for _, tc := range testCases {
+		cosState, err := ExtractPhase(eventLog, uint8(cel.CCMRType), tc.phase)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Fatalf("ExtractPhase(%d) returned error %v, want error: %v", tc.phase, err, tc.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if diff := cmp.Diff(cosState.GetContainer(), tc.want, protocmp.Transform()); diff != "" {
+			t.Errorf("ExtractPhase(%d) unexpected container state diff: \n%v", tc.phase, diff)
+		}
+	}
+
+	// An unterminated final phase is still selectable.
+	unterminated := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events[:5])
+	cosState, err := ExtractPhase(unterminated, uint8(cel.CCMRType), 1)
+	if err != nil {
+		t.Fatalf("ExtractPhase(1) on unterminated log returned error: %v", err)
+	}
+	if got := cosState.GetContainer().GetImageReference(); got != "docker.io/library/second:latest" {
+		t.Errorf("ExtractPhase(1) on unterminated log got image reference %q, want %q", got, "docker.io/library/second:latest")
+	}
+
+	// Records outside the selected phase are still verified.
+	eventLog.Records()[4].Digests[crypto.SHA384][0] ^= 0xff
+	if _, err := ExtractPhase(eventLog, uint8(cel.CCMRType), 0); err == nil {
+		t.Errorf("ExtractPhase(0) with a tampered record in phase 1 returned nil error, want error")
+	}
+}
+
+func TestExtractCOSStateLaunchFailed(t *testing.T) {
+	failure := coscel.COSTLV{EventType: coscel.LaunchFailedType, EventContent: []byte("failed to pull image")}
+	imageRef := coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")}
+	testCases := []struct {
+		name            string
+		events          []coscel.COSTLV
+		opts            Options
+		wantErr         bool
+		wantFailed      bool
+		wantLaunchError string
+	}{
+		{name: "no failure", events: []coscel.COSTLV{imageRef}},
+		{name: "failure rejected by default", events: []coscel.COSTLV{imageRef, failure}, wantErr: true},
+		{name: "failure tolerated", events: []coscel.COSTLV{imageRef, failure}, opts: Options{AllowLaunchFailure: true}, wantFailed: true, wantLaunchError: "failed to pull image"},
+		{name: "failure without reason", events: []coscel.COSTLV{{EventType: coscel.LaunchFailedType}}, opts: Options{AllowLaunchFailure: true}, wantFailed: true},
+		{name: "duplicate failure", events: []coscel.COSTLV{failure, failure}, opts: Options{AllowLaunchFailure: true}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), tc.opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if state.LaunchFailed != tc.wantFailed {
+				t.Errorf("ExtractCOSState() got LaunchFailed %v, want %v", state.LaunchFailed, tc.wantFailed)
+			}
+			if state.LaunchError != tc.wantLaunchError {
+				t.Errorf("ExtractCOSState() got LaunchError %q, want %q", state.LaunchError, tc.wantLaunchError)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateSkipNonCOSRecords(t *testing.T) {
+	noopExtender := func(crypto.Hash, int, []byte) error { return nil }
+	hashes := []crypto.Hash{crypto.SHA384}
+	eventLog := cel.NewConfComputeMR()
+	appendEvent := func(event cel.Content, mrIndex int) {
+		t.Helper()
+		if err := eventLog.AppendEvent(event, hashes, mrIndex, noopExtender); err != nil {
+			t.Fatal(err)
+		}
+	}
+	foreignEvent, err := generateNonCOSCELEvent(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Interleave non-COS events, measured into other registers, with COS events.
+	appendEvent(foreignEvent, 1)
+	appendEvent(coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")}, coscel.COSCCELMRIndex)
+	appendEvent(foreignEvent, 2)
+	appendEvent(coscel.COSTLV{EventType: coscel.ArgType, EventContent: []byte("--x")}, coscel.COSCCELMRIndex)
+
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{}); err == nil {
+		t.Errorf("ExtractCOSState() with interleaved non-COS records returned nil error, want error")
+	}
+
+	wantContainer := &attestationpb.ContainerState{ImageReference: "docker.io/library/hello-world:latest", Args: []string{"--x"}}
+	for _, opts := range []Options{
+		{SkipNonCOSRecords: true},
+		{SkipNonCOSRecords: true, VerifySkippedRecordDigests: true},
+	} {
+		state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts)
+		if err != nil {
+			t.Fatalf("ExtractCOSState(%+v) returned error: %v", opts, err)
+		}
+		if diff := cmp.Diff(state.GetContainer(), wantContainer, protocmp.Transform()); diff != "" {
+			t.Errorf("ExtractCOSState(%+v) unexpected container state diff: \n%v", opts, diff)
+		}
+	}
+
+	// Tampering with a skipped record is only caught when its digests are verified.
+	eventLog.Records()[2].Digests[crypto.SHA384][0] ^= 0xff
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{SkipNonCOSRecords: true}); err != nil {
+		t.Errorf("ExtractCOSState() with tampered skipped record returned error %v, want nil", err)
+	}
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{SkipNonCOSRecords: true, VerifySkippedRecordDigests: true}); err == nil {
+		t.Errorf("ExtractCOSState() verifying tampered skipped record returned nil error, want error")
+	}
+
+	// Non-COS content measured into a COS register is never skipped.
+	appendEvent(foreignEvent, coscel.COSCCELMRIndex)
+	opts := Options{SkipNonCOSRecords: true}
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); err == nil {
+		t.Errorf("ExtractCOSState() with non-COS record in COS register returned nil error, want error")
+	}
+	wantErr := "is not a COS TLV"
+	if _, err := DetectRegisterType(eventLog, opts); err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("DetectRegisterType() returned error %v, want error: %v", err, wantErr)
+	}
+}
+
+func TestExtractCOSStateAllowedEnvNames(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.EnvVarType, EventContent: []byte("foo=bar")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("bar=baz")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("bar=baz")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("qux=quux")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	testCases := []struct {
+		name        string
+		allowed     []string
+		wantErr     bool
+		wantInError []string
+	}{
+		{name: "no allowlist", allowed: nil},
+		{name: "all names allowed", allowed: []string{"foo", "bar", "qux", "unused"}},
+		{name: "base name disallowed", allowed: []string{"bar", "qux"}, wantErr: true, wantInError: []string{"foo"}},
+		{name: "overridden name disallowed", allowed: []string{"foo", "bar"}, wantErr: true, wantInError: []string{"qux"}},
+		{name: "empty allowlist", allowed: []string{}, wantErr: true, wantInError: []string{"bar", "foo", "qux"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{AllowedEnvNames: tc.allowed})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			for _, name := range tc.wantInError {
+				if !strings.Contains(err.Error(), name) {
+					t.Errorf("ExtractCOSState() error %q does not report disallowed name %q", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifiedCOSStateVerifyDigestAlgs(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+	}
+	testCases := []struct {
+		name    string
+		verify  []crypto.Hash
+		tamper  crypto.Hash
+		wantErr bool
+	}{
+		{name: "verify all banks", verify: nil},
+		{name: "verify quoted bank", verify: []crypto.Hash{crypto.SHA384}},
+		{name: "unverified bank tampered", verify: []crypto.Hash{crypto.SHA384}, tamper: crypto.SHA256},
+		{name: "verified bank tampered", verify: []crypto.Hash{crypto.SHA256}, tamper: crypto.SHA256, wantErr: true},
+		{name: "all banks with one tampered", verify: nil, tamper: crypto.SHA256, wantErr: true},
+		{name: "selected bank missing", verify: []crypto.Hash{crypto.SHA512}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCELWithHashes(t, cel.CCMRType, coscel.COSCCELMRIndex, []crypto.Hash{crypto.SHA256, crypto.SHA384}, events)
+			if tc.tamper != 0 {
+				eventLog.Records()[0].Digests[tc.tamper][0] ^= 0xff
+			}
+			_, err := VerifiedCOSState(eventLog, uint8(cel.CCMRType), Options{VerifyDigestAlgs: tc.verify})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("VerifiedCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateEventHandlers(t *testing.T) {
+	const customType coscel.ContentType = 200
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: customType, EventContent: []byte("first")},
+		{EventType: customType, EventContent: []byte("second")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{}); err == nil {
+		t.Errorf("ExtractCOSState() with an unhandled custom event type returned nil error, want error")
+	}
+
+	var custom []string
+	opts := Options{EventHandlers: map[coscel.ContentType]EventHandler{
+		customType: func(state *COSState, content []byte) error {
+			if state.GetContainer().GetImageReference() == "" {
+				return fmt.Errorf("custom event before image reference")
+			}
+			custom = append(custom, string(content))
+			return nil
+		},
+	}}
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); err != nil {
+		t.Fatalf("ExtractCOSState() with a custom event handler returned error: %v", err)
+	}
+	if diff := cmp.Diff(custom, []string{"first", "second"}); diff != "" {
+		t.Errorf("unexpected custom event contents diff: \n%v", diff)
+	}
+
+	// A handler error fails the extraction.
+	opts.EventHandlers[customType] = func(*COSState, []byte) error { return fmt.Errorf("bad content") }
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); err == nil {
+		t.Errorf("ExtractCOSState() with a failing custom event handler returned nil error, want error")
+	}
+
+	// Handlers cannot replace the built-in types.
+	opts.EventHandlers = map[coscel.ContentType]EventHandler{
+		coscel.ImageRefType: func(*COSState, []byte) error { return fmt.Errorf("unexpected call") },
+		customType:          func(*COSState, []byte) error { return nil },
+	}
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts)
+	if err != nil {
+		t.Fatalf("ExtractCOSState() with a built-in type handler returned error: %v", err)
+	}
+	if got := state.GetContainer().GetImageReference(); got != "docker.io/library/hello-world:latest" {
+		t.Errorf("ExtractCOSState() got image reference %q, want %q", got, "docker.io/library/hello-world:latest")
+	}
+}
+
+func TestExtractCOSStateMaxRecords(t *testing.T) {
+	var events []coscel.COSTLV
+	for i := 0; i < 5; i++ {
+		events = append(events, coscel.COSTLV{EventType: coscel.ArgType, EventContent: []byte(fmt.Sprintf("--arg%d", i))})
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	testCases := []struct {
+		name       string
+		maxRecords int
+		wantErr    bool
+	}{
+		{"default limit", 0, false},
+		{"at limit", 5, false},
+		{"exceeds limit", 4, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{MaxRecords: tc.maxRecords})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	// The limit is enforced before any record is processed, so a log exceeding
+	// it is rejected even if a record would fail verification on its own.
+	eventLog.Records()[0].Digests[crypto.SHA384][0] ^= 0xff
+	_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{MaxRecords: 1})
+	if err == nil || !strings.Contains(err.Error(), "exceeding the maximum") {
+		t.Errorf("ExtractCOSState() returned error %v, want record limit error", err)
+	}
+}
+
+func TestDetectRegisterType(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	}
+	for _, registerType := range []cel.MRType{cel.PCRType, cel.CCMRType} {
+		mrIndex := coscel.EventPCRIndex
+		if registerType == cel.CCMRType {
+			mrIndex = coscel.COSCCELMRIndex
+		}
+		got, err := DetectRegisterType(buildCEL(t, registerType, mrIndex, events), Options{})
+		if err != nil {
+			t.Errorf("DetectRegisterType() returned error: %v", err)
+		}
+		if got != uint8(registerType) {
+			t.Errorf("DetectRegisterType() = %d, want %d", got, registerType)
+		}
+	}
+
+	got, err := DetectRegisterType(cel.NewConfComputeMR(), Options{})
+	if err != nil || got != uint8(cel.CCMRType) {
+		t.Errorf("DetectRegisterType() of an empty log = %d, %v, want %d, nil", got, err, cel.CCMRType)
+	}
+
+	// A later record with a wrong index must fail detection, not only the first.
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	noopExtender := func(crypto.Hash, int, []byte) error { return nil }
+	if err := eventLog.AppendEvent(events[1], []crypto.Hash{crypto.SHA384}, 2, noopExtender); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DetectRegisterType(eventLog, Options{}); err == nil {
+		t.Errorf("DetectRegisterType() with a later record at a wrong index returned nil error, want error")
+	}
+	got, err = DetectRegisterType(eventLog, Options{AllowedCCMRIndices: []uint8{2, coscel.COSCCELMRIndex}})
+	if err != nil || got != uint8(cel.CCMRType) {
+		t.Errorf("DetectRegisterType() with the index allowed = %d, %v, want %d, nil", got, err, cel.CCMRType)
+	}
+
+	// A later record with a wrong index type must fail detection.
+	mixed := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	mixed.Records()[1].IndexType = cel.PCRType
+	mixed.Records()[1].Index = coscel.EventPCRIndex
+	if _, err := DetectRegisterType(mixed, Options{}); err == nil {
+		t.Errorf("DetectRegisterType() with mixed register types returned nil error, want error")
+	}
+}
+
+func TestExtractCOSStatePrivileged(t *testing.T) {
+	privileged := true
+	unprivileged := false
+	testCases := []struct {
+		name             string
+		events           []coscel.COSTLV
+		wantPrivileged   *bool
+		wantCapabilities []string
+		wantErr          bool
+	}{
+		{
+			name:   "not recorded",
+			events: nil,
+		},
+		{
+			name: "privileged launch",
+			events: []coscel.COSTLV{
+				{EventType: coscel.PrivilegedType, EventContent: []byte{1}},
+				{EventType: coscel.CapabilityType, EventContent: []byte("CAP_SYS_ADMIN")},
+				{EventType: coscel.CapabilityType, EventContent: []byte("CAP_NET_ADMIN")},
+			},
+			wantPrivileged:   &privileged,
+			wantCapabilities: []string{"CAP_SYS_ADMIN", "CAP_NET_ADMIN"},
+		},
+		{
+			name: "unprivileged launch",
+			events: []coscel.COSTLV{
+				{EventType: coscel.PrivilegedType, EventContent: []byte{0}},
+			},
+			wantPrivileged: &unprivileged,
+		},
+		{
+			name: "duplicate privileged",
+			events: []coscel.COSTLV{
+				{EventType: coscel.PrivilegedType, EventContent: []byte{0}},
+				{EventType: coscel.PrivilegedType, EventContent: []byte{0}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "malformed privileged",
+			events:  []coscel.COSTLV{{EventType: coscel.PrivilegedType, EventContent: []byte("true")}},
+			wantErr: true,
+		},
+		{
+			name:    "empty capability",
+			events:  []coscel.COSTLV{{EventType: coscel.CapabilityType}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Privileged, tc.wantPrivileged); diff != "" {
+				t.Errorf("unexpected privileged diff: \n%v", diff)
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Capabilities, tc.wantCapabilities); diff != "" {
+				t.Errorf("unexpected capabilities diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateValidateImageConsistency(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+	})
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{}); err != nil {
+		t.Errorf("ExtractCOSState() without image validation returned error: %v", err)
+	}
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{ValidateImageConsistency: true}); err == nil {
+		t.Errorf("ExtractCOSState() with image validation of a reference-only log returned nil error, want error")
+	}
+}
+
+func TestExtractCOSStateTeeTechnology(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    attestationpb.GCEConfidentialTechnology
+		wantErr bool
+	}{
+		{name: "not recorded", want: attestationpb.GCEConfidentialTechnology_NONE},
+		{name: "SEV-SNP", values: []string{attestationpb.GCEConfidentialTechnology_AMD_SEV_SNP.String()}, want: attestationpb.GCEConfidentialTechnology_AMD_SEV_SNP},
+		{name: "TDX", values: []string{attestationpb.GCEConfidentialTechnology_INTEL_TDX.String()}, want: attestationpb.GCEConfidentialTechnology_INTEL_TDX},
+		{name: "SEV", values: []string{attestationpb.GCEConfidentialTechnology_AMD_SEV.String()}, want: attestationpb.GCEConfidentialTechnology_AMD_SEV},
+		{name: "unknown", values: []string{"ARM_CCA"}, wantErr: true},
+		{name: "duplicate", values: []string{"INTEL_TDX", "AMD_SEV_SNP"}, wantErr: true},
+		{name: "NONE", values: []string{"NONE"}, wantErr: true},
+		{name: "NONE then TDX", values: []string{"NONE", "INTEL_TDX"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.TeeTechnologyType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.TeeTechnology != tc.want {
+				t.Errorf("ExtractCOSState() got TEE technology %v, want %v", state.TeeTechnology, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateRejectNULArgs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		eventType coscel.ContentType
+		arg       []byte
+		wantErr   bool
+	}{
+		{"clean arg", coscel.ArgType, []byte("--x"), false},
+		{"clean overridden arg", coscel.OverrideArgType, []byte("--x"), false},
+		{"arg with NUL", coscel.ArgType, []byte("--x\x00--y"), true},
+		{"overridden arg with NUL", coscel.OverrideArgType, []byte("--x\x00"), true},
+		{"NUL only", coscel.ArgType, []byte{0}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{{EventType: tc.eventType, EventContent: tc.arg}})
+			if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{}); err != nil {
+				t.Errorf("ExtractCOSState() without RejectNULArgs returned error: %v", err)
+			}
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{RejectNULArgs: true})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ExtractCOSState() with RejectNULArgs returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifiedCOSStateArgsOrder(t *testing.T) {
+	// Args deliberately out of lexical order, with duplicates and empty args,
+	// interleaved with other events.
+	args := []string{"--zeta", "", "--alpha", "--zeta", "value with spaces", "-m", "--beta"}
+	overriddenArgs := []string{"--y", "--x", "--y"}
+	var events []coscel.COSTLV
+	for i, arg := range args {
+		events = append(events, coscel.COSTLV{EventType: coscel.ArgType, EventContent: []byte(arg)})
+		if i < len(overriddenArgs) {
+			events = append(events, coscel.COSTLV{EventType: coscel.OverrideArgType, EventContent: []byte(overriddenArgs[i])})
+		}
+		events = append(events, coscel.COSTLV{EventType: coscel.EnvVarType, EventContent: []byte(fmt.Sprintf("env%d=%d", i, i))})
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	// Extract repeatedly to guard against any order dependent on map iteration.
+	for i := 0; i < 10; i++ {
+		cosState, err := VerifiedCOSState(eventLog, uint8(cel.CCMRType), Options{})
+		if err != nil {
+			t.Fatalf("VerifiedCOSState() returned error: %v", err)
+		}
+		if diff := cmp.Diff(cosState.GetContainer().GetArgs(), args); diff != "" {
+			t.Fatalf("Args not in log order, diff: \n%v", diff)
+		}
+		if diff := cmp.Diff(cosState.GetContainer().GetOverriddenArgs(), overriddenArgs); diff != "" {
+			t.Fatalf("OverriddenArgs not in log order, diff: \n%v", diff)
+		}
+	}
+}
+
+func TestExtractCOSStateDNS(t *testing.T) {
+	testCases := []struct {
+		name    string
+		events  []coscel.COSTLV
+		want    DNSConfig
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{
+			name: "resolver config",
+			events: []coscel.COSTLV{
+				{EventType: coscel.DNSServerType, EventContent: []byte("169.254.169.254")},
+				{EventType: coscel.DNSServerType, EventContent: []byte("2001:4860:4860::8888")},
+				{EventType: coscel.DNSSearchDomainType, EventContent: []byte("c.project.internal")},
+				{EventType: coscel.DNSSearchDomainType, EventContent: []byte("google.internal")},
+			},
+			want: DNSConfig{
+				Servers:       []string{"169.254.169.254", "2001:4860:4860::8888"},
+				SearchDomains: []string{"c.project.internal", "google.internal"},
+			},
+		},
+		{
+			name: "duplicate server",
+			events: []coscel.COSTLV{
+				{EventType: coscel.DNSServerType, EventContent: []byte("8.8.8.8")},
+				{EventType: coscel.DNSServerType, EventContent: []byte("8.8.8.8")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate search domain",
+			events: []coscel.COSTLV{
+				{EventType: coscel.DNSSearchDomainType, EventContent: []byte("google.internal")},
+				{EventType: coscel.DNSSearchDomainType, EventContent: []byte("google.internal")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "malformed server",
+			events:  []coscel.COSTLV{{EventType: coscel.DNSServerType, EventContent: []byte("dns.google")}},
+			wantErr: true,
+		},
+		{
+			name:    "empty search domain",
+			events:  []coscel.COSTLV{{EventType: coscel.DNSSearchDomainType}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.DNS, tc.want); diff != "" {
+				t.Errorf("unexpected DNS config diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateMounts(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mounts  []string
+		want    []Mount
+		wantErr bool
+	}{
+		{name: "no mounts"},
+		{
+			name: "multiple mounts",
+			mounts: []string{
+				"type=bind,source=/mnt/disks/data,target=/data,readonly",
+				"type=tmpfs,target=/tmp",
+				"type=bind,source=/var/run/secrets,target=/secrets",
+			},
+			want: []Mount{
+				{Type: "bind", Source: "/mnt/disks/data", Target: "/data", ReadOnly: true},
+				{Type: "tmpfs", Target: "/tmp"},
+				{Type: "bind", Source: "/var/run/secrets", Target: "/secrets"},
+			},
+		},
+		{name: "missing target", mounts: []string{"type=bind,source=/data"}, wantErr: true},
+		{name: "missing type", mounts: []string{"source=/data,target=/data"}, wantErr: true},
+		{name: "bind without source", mounts: []string{"type=bind,target=/data"}, wantErr: true},
+		{name: "unknown field", mounts: []string{"type=tmpfs,target=/tmp,size=1g"}, wantErr: true},
+		{name: "duplicate field", mounts: []string{"type=tmpfs,target=/tmp,target=/other"}, wantErr: true},
+		{name: "readonly with value", mounts: []string{"type=tmpfs,target=/tmp,readonly=false"}, wantErr: true},
+		{name: "empty", mounts: []string{""}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, mount := range tc.mounts {
+				events = append(events, coscel.COSTLV{EventType: coscel.MountType, EventContent: []byte(mount)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Mounts, tc.want); diff != "" {
+				t.Errorf("unexpected mounts diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateLaunchSeparatorPayload(t *testing.T) {
+	testCases := []struct {
+		name   string
+		events []coscel.COSTLV
+		want   string
+	}{
+		{name: "no separator", events: nil, want: ""},
+		{name: "separator without payload", events: []coscel.COSTLV{{EventType: coscel.LaunchSeparatorType}}, want: ""},
+		{name: "separator with payload", events: []coscel.COSTLV{{EventType: coscel.LaunchSeparatorType, EventContent: []byte("workload-start")}}, want: "workload-start"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := append([]coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")}}, tc.events...)
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if state.LaunchSeparatorPayload != tc.want {
+				t.Errorf("ExtractCOSState() got separator payload %q, want %q", state.LaunchSeparatorPayload, tc.want)
+			}
+		})
+	}
+
+	// A separator with a payload still ends the pre-launch events.
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.LaunchSeparatorType, EventContent: []byte("workload-start")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	})
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{}); err == nil {
+		t.Errorf("ExtractCOSState() with an event after a separator with payload returned nil error, want error")
+	}
+}
+
+func TestExtractCOSStatePlatform(t *testing.T) {
+	testCases := []struct {
+		name      string
+		platforms []string
+		want      *Platform
+		wantErr   bool
+	}{
+		{name: "not recorded"},
+		{name: "linux/amd64", platforms: []string{"linux/amd64"}, want: &Platform{OS: "linux", Architecture: "amd64"}},
+		{name: "linux/arm64/v8", platforms: []string{"linux/arm64/v8"}, want: &Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{name: "missing arch", platforms: []string{"linux"}, wantErr: true},
+		{name: "empty arch", platforms: []string{"linux/"}, wantErr: true},
+		{name: "too many components", platforms: []string{"linux/arm64/v8/extra"}, wantErr: true},
+		{name: "invalid characters", platforms: []string{"Linux/AMD64"}, wantErr: true},
+		{name: "duplicate", platforms: []string{"linux/amd64", "linux/amd64"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, platform := range tc.platforms {
+				events = append(events, coscel.COSTLV{EventType: coscel.PlatformType, EventContent: []byte(platform)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Platform, tc.want); diff != "" {
+				t.Errorf("unexpected platform diff: \n%v", diff)
+			}
+			if tc.want != nil && state.ContainerExtensions.Platform.String() != tc.platforms[0] {
+				t.Errorf("Platform.String() = %q, want %q", state.ContainerExtensions.Platform.String(), tc.platforms[0])
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateSealingPolicy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "policy hash", values: []string{"sha256:" + strings.Repeat("ab", 32)}, want: "sha256:" + strings.Repeat("ab", 32)},
+		{name: "policy identifier", values: []string{"projects/p/sealingPolicies/prod"}, want: "projects/p/sealingPolicies/prod"},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "duplicate", values: []string{"policy-a", "policy-b"}, wantErr: true},
+		{name: "duplicate same value", values: []string{"policy-a", "policy-a"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.SealingPolicyType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.SealingPolicy != tc.want {
+				t.Errorf("ExtractCOSState() got sealing policy %q, want %q", state.SealingPolicy, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateNormalizeRestartPolicy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		policy    string
+		normalize bool
+		want      attestationpb.RestartPolicy
+		wantErr   bool
+	}{
+		{name: "exact strict", policy: "OnFailure", want: attestationpb.RestartPolicy_OnFailure},
+		{name: "exact normalized", policy: "Never", normalize: true, want: attestationpb.RestartPolicy_Never},
+		{name: "lowercase strict", policy: "onfailure", wantErr: true},
+		{name: "lowercase normalized", policy: "onfailure", normalize: true, want: attestationpb.RestartPolicy_OnFailure},
+		{name: "uppercase normalized", policy: "NEVER", normalize: true, want: attestationpb.RestartPolicy_Never},
+		{name: "mixed case normalized", policy: "aLwAyS", normalize: true, want: attestationpb.RestartPolicy_Always},
+		{name: "whitespace strict", policy: " Never\n", wantErr: true},
+		{name: "whitespace normalized", policy: " \tonFailure \n", normalize: true, want: attestationpb.RestartPolicy_OnFailure},
+		{name: "unknown normalized", policy: "sometimes", normalize: true, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := []coscel.COSTLV{{EventType: coscel.RestartPolicyType, EventContent: []byte(tc.policy)}}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{NormalizeRestartPolicy: tc.normalize})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.GetContainer().GetRestartPolicy() != tc.want {
+				t.Errorf("ExtractCOSState() got restart policy %v, want %v", state.GetContainer().GetRestartPolicy(), tc.want)
+			}
+		})
+	}
+}
+
+// TestParsingRTMREventlogAlternateCCMRIndex covers TDX platforms measuring COS
+// events into CCMR 3 (RTMR 2) instead of COSCCELMRIndex.
+func TestParsingRTMREventlogAlternateCCMRIndex(t *testing.T) {
+	const alternateCCMRIndex = 3
+	fakeRTMR := fakertmr.CreateRtmrSubsystem(t.TempDir())
+	rtmrExtender := func(_ crypto.Hash, mrIndex int, digest []byte) error {
+		return rtmr.ExtendDigestClient(fakeRTMR, mrIndex-1, digest) // MR_INDEX - 1 == RTMR_INDEX
+	}
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+		{EventType: coscel.RestartPolicyType, EventContent: []byte(attestationpb.RestartPolicy_Never.String())},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("foo=bar")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	acoscel := cel.NewConfComputeMR()
+	for _, event := range events {
+		if err := acoscel.AppendEvent(event, []crypto.Hash{crypto.SHA384}, alternateCCMRIndex, rtmrExtender); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := acoscel.EncodeCEL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rtmrBank := getRTMRBank(t, fakeRTMR)
+
+	wantContainerState := &attestationpb.ContainerState{
+		ImageReference:    string(events[0].EventContent),
+		ImageDigest:       testImageDigest,
+		RestartPolicy:     attestationpb.RestartPolicy_Never,
+		Args:              []string{"--x"},
+		EnvVars:           map[string]string{"foo": "bar"},
+		OverriddenEnvVars: map[string]string{},
+	}
+	testCases := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"default index", Options{}, true},
+		{"PCR override does not apply", Options{AllowedPCRIndices: []uint8{alternateCCMRIndex}}, true},
+		{"alternate index", Options{AllowedCCMRIndices: []uint8{alternateCCMRIndex}}, false},
+		{"alternate and default index", Options{AllowedCCMRIndices: []uint8{coscel.COSCCELMRIndex, alternateCCMRIndex}}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			acosState, err := ParseCOSCEL(buf.Bytes(), rtmrBank, tc.opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ParseCOSCEL() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(acosState.GetContainer(), wantContainerState, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected container state difference:\n%v", diff)
+			}
+		})
+	}
+
+	// The replay must bind the records to the alternate register: the log
+	// does not replay against a bank where the events went to the default
+	// register.
+	otherRTMR := fakertmr.CreateRtmrSubsystem(t.TempDir())
+	for _, event := range events {
+		digest, err := event.GenerateDigest(crypto.SHA384)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rtmr.ExtendDigestClient(otherRTMR, coscel.COSCCELMRIndex-1, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ParseCOSCEL(buf.Bytes(), getRTMRBank(t, otherRTMR), Options{AllowedCCMRIndices: []uint8{alternateCCMRIndex}}); err == nil {
+		t.Error("ParseCOSCEL() replayed the alternate index log against the default register, want error")
+	}
+}
+
+func TestExtractCOSStatePopulateEvents(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")},
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/b:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType, EventContent: []byte{}},
+		{EventType: coscel.ArgType, EventContent: []byte("--y")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{PopulateEvents: true, Tolerant: true})
+	if err == nil {
+		t.Fatal("ExtractCOSState() returned nil error for a duplicate ImageRef, want *MultiError")
+	}
+	var want []Event
+	for i, event := range events {
+		want = append(want, Event{
+			RecNum:         uint64(i),
+			Index:          coscel.COSCCELMRIndex,
+			Type:           event.EventType,
+			Content:        event.EventContent,
+			DigestVerified: true,
+			// The duplicate ImageRef and the event after the separator are
+			// rejected.
+			Applied: i != 1 && i != 4,
+		})
+	}
+	if diff := cmp.Diff(want, state.Events); diff != "" {
+		t.Errorf("ExtractCOSState() returned unexpected events diff (-want +got):\n%s", diff)
+	}
+
+	state, err = ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{Tolerant: true})
+	if state == nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+	if state.Events != nil {
+		t.Errorf("ExtractCOSState() without PopulateEvents got events %v, want nil", state.Events)
+	}
+}
+
+func TestExtractCOSStateReservedEnvNames(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.EnvVarType, EventContent: []byte("foo=bar")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("TEE_RESERVED=x")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("TEE_RESERVED=y")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("LAUNCHER_TOKEN=z")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	testCases := []struct {
+		name         string
+		reserved     []string
+		warn         bool
+		wantErr      bool
+		wantWarnings []string
+	}{
+		{name: "no reserved names"},
+		{name: "clean", reserved: []string{"UNUSED"}},
+		{name: "collision", reserved: []string{"TEE_RESERVED"}, wantErr: true},
+		{name: "overridden collision", reserved: []string{"LAUNCHER_TOKEN"}, wantErr: true},
+		{name: "clean with warnings", reserved: []string{"UNUSED"}, warn: true},
+		{
+			name:         "collisions as warnings",
+			reserved:     []string{"TEE_RESERVED", "LAUNCHER_TOKEN"},
+			warn:         true,
+			wantWarnings: []string{"found env vars with reserved names: [LAUNCHER_TOKEN TEE_RESERVED]"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{ReservedEnvNames: tc.reserved, WarnOnReservedEnvNames: tc.warn})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.wantWarnings, state.Warnings); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected warnings diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateRequireSeparator(t *testing.T) {
+	imageRef := coscel.COSTLV{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")}
+	separator := coscel.COSTLV{EventType: coscel.LaunchSeparatorType}
+	testCases := []struct {
+		name    string
+		events  []coscel.COSTLV
+		opts    Options
+		wantErr bool
+	}{
+		{"separator not required", []coscel.COSTLV{imageRef}, Options{}, false},
+		{"separator required and present", []coscel.COSTLV{imageRef, separator}, Options{RequireSeparator: true}, false},
+		{"separator required and absent", []coscel.COSTLV{imageRef}, Options{RequireSeparator: true}, true},
+		{"separator required in empty log", nil, Options{RequireSeparator: true}, true},
+		{"separator required and absent, tolerant", []coscel.COSTLV{imageRef}, Options{RequireSeparator: true, Tolerant: true}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), tc.opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateSecondSeparator(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")},
+		{EventType: coscel.LaunchSeparatorType},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	for _, opts := range []Options{{}, {Tolerant: true}} {
+		_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts)
+		if err == nil || !strings.Contains(err.Error(), "found second LaunchSeparator event") {
+			t.Errorf("ExtractCOSState(%+v) returned error %v, want error: found second LaunchSeparator event", opts, err)
+		}
+	}
+}
+
+func TestExtractCOSStateProbeConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		probes  []string
+		want    []ProbeConfig
+		wantErr bool
+	}{
+		{name: "no probes"},
+		{
+			name: "liveness and readiness",
+			probes: []string{
+				"kind=liveness,type=http,target=/healthz,period=10s,timeout=1s",
+				"kind=readiness,type=tcp,target=8080",
+			},
+			want: []ProbeConfig{
+				{Kind: "liveness", Type: "http", Target: "/healthz", Period: 10 * time.Second, Timeout: time.Second},
+				{Kind: "readiness", Type: "tcp", Target: "8080"},
+			},
+		},
+		{name: "missing target", probes: []string{"kind=liveness,type=http"}, wantErr: true},
+		{name: "unknown kind", probes: []string{"kind=shutdown,type=http,target=/"}, wantErr: true},
+		{name: "unknown type", probes: []string{"kind=liveness,type=grpc,target=:9000"}, wantErr: true},
+		{name: "malformed period", probes: []string{"kind=liveness,type=http,target=/,period=often"}, wantErr: true},
+		{name: "negative timeout", probes: []string{"kind=liveness,type=http,target=/,timeout=-1s"}, wantErr: true},
+		{name: "unknown field", probes: []string{"kind=liveness,type=http,target=/,retries=3"}, wantErr: true},
+		{name: "field without value", probes: []string{"kind=liveness,type=http,target=/,period"}, wantErr: true},
+		{name: "duplicate field", probes: []string{"kind=liveness,type=http,target=/,target=/other"}, wantErr: true},
+		{name: "duplicate kind", probes: []string{"kind=liveness,type=http,target=/", "kind=liveness,type=tcp,target=80"}, wantErr: true},
+		{name: "empty", probes: []string{""}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, probe := range tc.probes {
+				events = append(events, coscel.COSTLV{EventType: coscel.ProbeConfigType, EventContent: []byte(probe)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Probes, tc.want); diff != "" {
+				t.Errorf("unexpected probes diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateGrantedResources(t *testing.T) {
+	testCases := []struct {
+		name      string
+		resources []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "no grants"},
+		{
+			name:      "multiple grants",
+			resources: []string{"projects/p/secrets/db-password/versions/1", "projects/p/secrets/api-key/versions/latest", "//storage.googleapis.com/projects/_/buckets/data"},
+			want:      []string{"projects/p/secrets/db-password/versions/1", "projects/p/secrets/api-key/versions/latest", "//storage.googleapis.com/projects/_/buckets/data"},
+		},
+		{name: "duplicate", resources: []string{"projects/p/secrets/a", "projects/p/secrets/b", "projects/p/secrets/a"}, wantErr: true},
+		{name: "empty", resources: []string{""}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, resource := range tc.resources {
+				events = append(events, coscel.COSTLV{EventType: coscel.GrantedResourceType, EventContent: []byte(resource)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.GrantedResources, tc.want); diff != "" {
+				t.Errorf("unexpected granted resources diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateInsecureTolerateDigestFailures(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/tampered:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	eventLog.Records()[0].Digests[crypto.SHA384][0] ^= 0xff
+
+	for _, opts := range []Options{
+		{},
+		{Tolerant: true},
+		{InsecureTolerateDigestFailures: true},
+	} {
+		if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); err == nil {
+			t.Errorf("ExtractCOSState(%+v) of a tampered log returned nil error, want error", opts)
+		}
+	}
+
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{Tolerant: true, InsecureTolerateDigestFailures: true, PopulateEvents: true})
+	if err != nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+	if got := state.GetContainer().GetImageReference(); got != string(events[0].EventContent) {
+		t.Errorf("ExtractCOSState() got image reference %q, want the tampered %q", got, events[0].EventContent)
+	}
+	if len(state.Warnings) != 1 || !strings.HasPrefix(state.Warnings[0], "INSECURE: CEL record 0 failed digest verification") {
+		t.Errorf("ExtractCOSState() got warnings %q, want a single digest failure warning for record 0", state.Warnings)
+	}
+	if len(state.Events) != 2 || state.Events[0].DigestVerified || !state.Events[1].DigestVerified {
+		t.Errorf("ExtractCOSState() got events %+v, want only record 1 digest verified", state.Events)
+	}
+
+	// OnEvent only sees events whose digests were verified.
+	var seen []coscel.ContentType
+	opts := Options{Tolerant: true, InsecureTolerateDigestFailures: true, OnEvent: func(cosTlv coscel.COSTLV) error {
+		seen = append(seen, cosTlv.EventType)
+		return nil
+	}}
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); err != nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+	if diff := cmp.Diff([]coscel.ContentType{coscel.ArgType}, seen); diff != "" {
+		t.Errorf("ExtractCOSState() passed unexpected events to OnEvent (-want +got):\n%s", diff)
+	}
+}
+
+func TestExtractCOSStateTerminationGracePeriod(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    *time.Duration
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "30 seconds", values: []string{"30"}, want: ptr(30 * time.Second)},
+		{name: "zero", values: []string{"0"}, want: ptr(time.Duration(0))},
+		{name: "negative", values: []string{"-1"}, wantErr: true},
+		{name: "duration string", values: []string{"30s"}, wantErr: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "too large", values: []string{"4294967296"}, wantErr: true},
+		{name: "duplicate", values: []string{"30", "30"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.TerminationGracePeriodType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.TerminationGracePeriod, tc.want); diff != "" {
+				t.Errorf("unexpected termination grace period diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateRestartCount(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    *uint32
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "zero", values: []string{"0"}, want: ptr(uint32(0))},
+		{name: "nonzero", values: []string{"3"}, want: ptr(uint32(3))},
+		{name: "negative", values: []string{"-1"}, wantErr: true},
+		{name: "not a number", values: []string{"three"}, wantErr: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "duplicate", values: []string{"1", "2"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.RestartCountType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.RestartCount, tc.want); diff != "" {
+				t.Errorf("unexpected restart count diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateKernelCmdline(t *testing.T) {
+	const cmdline = "BOOT_IMAGE=/syslinux/vmlinuz.A init=/usr/lib/systemd/systemd boot=local rootwait ro noresume loglevel=7 console=ttyS0 dm_verity.error_behavior=3"
+	testCases := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "cmdline", values: []string{cmdline}, want: cmdline},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "duplicate", values: []string{cmdline, cmdline}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.KernelCmdlineType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.BootState.KernelCmdline != tc.want {
+				t.Errorf("ExtractCOSState() got kernel cmdline %q, want %q", state.BootState.KernelCmdline, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateLoggingConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		values      []string
+		want        *LoggingConfig
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{name: "not recorded"},
+		{name: "disabled", values: []string{"disabled"}, want: &LoggingConfig{}},
+		{name: "cloud logging", values: []string{"cloud_logging"}, want: &LoggingConfig{CloudLogging: true}, wantEnabled: true},
+		{name: "all destinations", values: []string{"serial,cloud_logging"}, want: &LoggingConfig{CloudLogging: true, Serial: true}, wantEnabled: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "unknown destination", values: []string{"syslog"}, wantErr: true},
+		{name: "disabled with destination", values: []string{"disabled,serial"}, wantErr: true},
+		{name: "duplicate destination", values: []string{"serial,serial"}, wantErr: true},
+		{name: "duplicate event", values: []string{"serial", "disabled"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.LoggingConfigType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.LoggingConfig, tc.want); diff != "" {
+				t.Errorf("unexpected logging config diff: \n%v", diff)
+			}
+			if config := state.ContainerExtensions.LoggingConfig; config != nil && config.Enabled() != tc.wantEnabled {
+				t.Errorf("LoggingConfig.Enabled() = %v, want %v", config.Enabled(), tc.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateEnvAndOverrideLimits(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.OverrideArgType, EventContent: []byte("--a")},
+		{EventType: coscel.OverrideArgType, EventContent: []byte("--b")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("FOO=0")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("BAZ=0")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("FOO=1")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("BAR=2")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("BAR=3")},
+	}
+	testCases := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "unlimited"},
+		{name: "within caps", opts: Options{MaxOverriddenArgs: 2, MaxOverriddenEnvVars: 2}},
+		{name: "too many args", opts: Options{MaxOverriddenArgs: 1}, wantErr: "found 2 overridden args, exceeding the maximum of 1"},
+		{name: "too many env vars", opts: Options{MaxOverriddenEnvVars: 1}, wantErr: "found 2 overridden env vars, exceeding the maximum of 1"},
+		{name: "distinct env vars at limit", opts: Options{MaxDistinctEnvVars: 3}},
+		{name: "too many distinct env vars", opts: Options{MaxDistinctEnvVars: 2}, wantErr: "found 3 distinct env vars, exceeding the maximum of 2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), tc.opts)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("ExtractCOSState() returned error %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxDistinctEnvVarsAbortsEarly(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.EnvVarType, EventContent: []byte("FOO=0")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("BAR=1")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	// Tamper with a later record, which fails the extraction if processed.
+	eventLog.Records()[2].Digests[crypto.SHA384][0] ^= 0xff
+
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{Tolerant: true, MaxDistinctEnvVars: 1})
+	wantErr := "CEL record 1: found 2 distinct env vars, exceeding the maximum of 1"
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, wantErr)
+	}
+	if state != nil {
+		t.Errorf("ExtractCOSState() returned state %v, want nil", state)
+	}
+}
+
+func TestExtractCOSStateVulnerabilityScan(t *testing.T) {
+	const occurrence = "projects/test-project/occurrences/5d3e0c6a-1f2b-4c3d-9e8f-7a6b5c4d3e2f"
+	testCases := []struct {
+		name    string
+		values  []string
+		want    *VulnerabilityScan
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "clean", values: []string{"clean:" + occurrence}, want: &VulnerabilityScan{Clean: true, Attestation: occurrence}},
+		{name: "flagged", values: []string{"flagged:" + occurrence}, want: &VulnerabilityScan{Attestation: occurrence}},
+		{name: "attestation with colon", values: []string{"clean:sha256:abcd"}, want: &VulnerabilityScan{Clean: true, Attestation: "sha256:abcd"}},
+		{name: "no attestation", values: []string{"clean"}, wantErr: true},
+		{name: "empty attestation", values: []string{"clean:"}, wantErr: true},
+		{name: "unknown result", values: []string{"passed:" + occurrence}, wantErr: true},
+		{name: "duplicate", values: []string{"clean:" + occurrence, "flagged:" + occurrence}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.VulnerabilityScanType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.VulnerabilityScan, tc.want); diff != "" {
+				t.Errorf("unexpected vulnerability scan diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStatePlatformMismatch(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    *Platform
+		wantErr bool
+	}{
+		{name: "absent"},
+		{name: "present", values: []string{"linux/amd64"}, want: &Platform{OS: "linux", Architecture: "amd64"}},
+		{name: "malformed", values: []string{"amd64"}, wantErr: true},
+		{name: "duplicate", values: []string{"linux/amd64", "linux/amd64"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := []coscel.COSTLV{{EventType: coscel.PlatformType, EventContent: []byte("linux/arm64/v8")}}
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.PlatformMismatchType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.HostPlatform, tc.want); diff != "" {
+				t.Errorf("unexpected host platform diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateInstanceMetadata(t *testing.T) {
+	const metadata = "projects/test-project/zones/us-central1-a/instances/1234567890123456789"
+	testCases := []struct {
+		name    string
+		values  []string
+		want    *InstanceMetadata
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "valid", values: []string{metadata}, want: &InstanceMetadata{ProjectID: "test-project", Zone: "us-central1-a", InstanceID: 1234567890123456789}},
+		{name: "duplicate", values: []string{metadata, metadata}, wantErr: true},
+		{name: "instance name", values: []string{"projects/test-project/zones/us-central1-a/instances/my-vm"}, wantErr: true},
+		{name: "missing zone", values: []string{"projects/test-project/instances/1"}, wantErr: true},
+		{name: "empty project", values: []string{"projects//zones/us-central1-a/instances/1"}, wantErr: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.InstanceMetadataType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.InstanceMetadata, tc.want); diff != "" {
+				t.Errorf("unexpected instance metadata diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateDigestVerifier(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCELWithHashes(t, cel.CCMRType, coscel.COSCCELMRIndex, []crypto.Hash{crypto.SHA256, crypto.SHA384}, events)
+	// Tampering is not detected, since the mock verifier replaces local hashing.
+	eventLog.Records()[1].Digests[crypto.SHA384][0] ^= 0xff
+
+	var verified []uint64
+	var verifiedAlgs [][]crypto.Hash
+	opts := Options{
+		VerifyDigestAlgs: []crypto.Hash{crypto.SHA384},
+		DigestVerifier: func(record cel.Record, _ cel.Content, digests map[crypto.Hash][]byte) error {
+			verified = append(verified, record.RecNum)
+			verifiedAlgs = append(verifiedAlgs, slices.Collect(maps.Keys(digests)))
+			return nil
+		},
+	}
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); err != nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+	if diff := cmp.Diff(verified, []uint64{0, 1, 2}); diff != "" {
+		t.Errorf("unexpected verified records diff: \n%v", diff)
+	}
+	if diff := cmp.Diff(verifiedAlgs, [][]crypto.Hash{{crypto.SHA384}, {crypto.SHA384}, {crypto.SHA384}}); diff != "" {
+		t.Errorf("unexpected verified digest algorithms diff: \n%v", diff)
+	}
+
+	errHSM := errors.New("HSM unavailable")
+	opts.DigestVerifier = func(cel.Record, cel.Content, map[crypto.Hash][]byte) error { return errHSM }
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts); !errors.Is(err, errHSM) {
+		t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, errHSM)
+	}
+}
+
+func TestExtractCOSStatePullCredentialSource(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    CredentialSource
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "anonymous", values: []string{"anonymous"}, want: CredentialSourceAnonymous},
+		{name: "service account", values: []string{"service_account"}, want: CredentialSourceServiceAccount},
+		{name: "workload identity", values: []string{"workload_identity"}, want: CredentialSourceWorkloadIdentity},
+		{name: "key", values: []string{"key"}, want: CredentialSourceKey},
+		{name: "unknown", values: []string{"docker_config"}, wantErr: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "duplicate", values: []string{"key", "anonymous"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.PullCredentialSourceType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.ContainerExtensions.PullCredentialSource != tc.want {
+				t.Errorf("ExtractCOSState() got pull credential source %q, want %q", state.ContainerExtensions.PullCredentialSource, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsCOSEventLog(t *testing.T) {
+	cosLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.LaunchSeparatorType},
+	})
+	if !IsCOSEventLog(cosLog, uint8(cel.CCMRType)) {
+		t.Errorf("IsCOSEventLog() of a COS log = false, want true")
+	}
+	if IsCOSEventLog(cosLog, uint8(cel.PCRType)) {
+		t.Errorf("IsCOSEventLog() of a COS log with another register type = true, want false")
+	}
+
+	foreignLog := cel.NewConfComputeMR()
+	for range 3 {
+		foreignEvent, err := generateNonCOSCELEvent([]crypto.Hash{crypto.SHA384})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := foreignLog.AppendEvent(foreignEvent, []crypto.Hash{crypto.SHA384}, 2, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+			t.Fatalf("AppendEvent() returned error: %v", err)
+		}
+	}
+	if IsCOSEventLog(foreignLog, uint8(cel.CCMRType)) {
+		t.Errorf("IsCOSEventLog() of a non-COS log = true, want false")
+	}
+	if IsCOSEventLog(cel.NewConfComputeMR(), uint8(cel.CCMRType)) {
+		t.Errorf("IsCOSEventLog() of an empty log = true, want false")
+	}
+}
+
+func TestExtractCOSStateReadOnlyRootfs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  [][]byte
+		want    *bool
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "enabled", values: [][]byte{{1}}, want: ptr(true)},
+		{name: "disabled", values: [][]byte{{0}}, want: ptr(false)},
+		{name: "string payload", values: [][]byte{[]byte("true")}, wantErr: true},
+		{name: "out of range", values: [][]byte{{2}}, wantErr: true},
+		{name: "empty", values: [][]byte{{}}, wantErr: true},
+		{name: "duplicate", values: [][]byte{{1}, {1}}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.ReadOnlyRootfsType, EventContent: value})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.ReadOnlyRootfs, tc.want); diff != "" {
+				t.Errorf("unexpected read-only rootfs diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateDigestAlgs(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	}
+
+	t.Run("single algorithm", func(t *testing.T) {
+		eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+		state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{PopulateDigestAlgs: true})
+		if err != nil {
+			t.Fatalf("ExtractCOSState() returned error: %v", err)
+		}
+		want := map[uint64][]crypto.Hash{0: {crypto.SHA384}, 1: {crypto.SHA384}}
+		if diff := cmp.Diff(state.DigestAlgs, want); diff != "" {
+			t.Errorf("unexpected digest algorithms diff: \n%v", diff)
+		}
+	})
+
+	t.Run("mixed algorithms", func(t *testing.T) {
+		eventLog := buildCELWithHashes(t, cel.PCRType, coscel.EventPCRIndex, []crypto.Hash{crypto.SHA384, crypto.SHA1}, events[:1])
+		if err := eventLog.AppendEvent(events[1], []crypto.Hash{crypto.SHA256}, coscel.EventPCRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+			t.Fatalf("AppendEvent() returned error: %v", err)
+		}
+		state, err := ExtractCOSState(eventLog, uint8(cel.PCRType), Options{PopulateDigestAlgs: true})
+		if err != nil {
+			t.Fatalf("ExtractCOSState() returned error: %v", err)
+		}
+		want := map[uint64][]crypto.Hash{0: {crypto.SHA1, crypto.SHA384}, 1: {crypto.SHA256}}
+		if diff := cmp.Diff(state.DigestAlgs, want); diff != "" {
+			t.Errorf("unexpected digest algorithms diff: \n%v", diff)
+		}
+	})
+
+	t.Run("not populated", func(t *testing.T) {
+		eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+		state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+		if err != nil {
+			t.Fatalf("ExtractCOSState() returned error: %v", err)
+		}
+		if state.DigestAlgs != nil {
+			t.Errorf("ExtractCOSState() populated digest algorithms %v without PopulateDigestAlgs", state.DigestAlgs)
+		}
+	})
+}
+
+func TestExtractCOSStateSeccompProfile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "named profile", values: []string{"localhost/restricted.json"}, want: "localhost/restricted.json"},
+		{name: "default", values: []string{"default"}, want: SeccompProfileDefault},
+		{name: "unconfined", values: []string{"unconfined"}, want: SeccompProfileUnconfined},
+		{name: "empty name", values: []string{"localhost/"}, wantErr: true},
+		{name: "unknown", values: []string{"RuntimeDefault"}, wantErr: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+		{name: "duplicate", values: []string{"default", "unconfined"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.SeccompProfileType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.ContainerExtensions.SeccompProfile != tc.want {
+				t.Errorf("ExtractCOSState() got seccomp profile %q, want %q", state.ContainerExtensions.SeccompProfile, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateNetworkMode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "host", values: []string{"host"}, want: NetworkModeHost},
+		{name: "bridge", values: []string{"bridge"}, want: NetworkModeBridge},
+		{name: "none", values: []string{"none"}, want: NetworkModeNone},
+		{name: "unknown", values: []string{"container:other"}, wantErr: true},
+		{name: "wrong case", values: []string{"Host"}, wantErr: true},
+		{name: "duplicate", values: []string{"none", "host"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.NetworkModeType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err == nil && state.ContainerExtensions.NetworkMode != tc.want {
+				t.Errorf("ExtractCOSState() got network mode %q, want %q", state.ContainerExtensions.NetworkMode, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateAccelerators(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    []Accelerator
+		wantErr bool
+	}{
+		{name: "no accelerators"},
+		{
+			name:   "GPUs attached",
+			values: []string{"nvidia-h100-80gb=8", "nvidia-tesla-t4=1"},
+			want:   []Accelerator{{Type: "nvidia-h100-80gb", Count: 8}, {Type: "nvidia-tesla-t4", Count: 1}},
+		},
+		{name: "zero count", values: []string{"nvidia-h100-80gb=0"}, wantErr: true},
+		{name: "no count", values: []string{"nvidia-h100-80gb"}, wantErr: true},
+		{name: "no type", values: []string{"=1"}, wantErr: true},
+		{name: "duplicate type", values: []string{"nvidia-h100-80gb=1", "nvidia-h100-80gb=2"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.AcceleratorType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Accelerators, tc.want); diff != "" {
+				t.Errorf("unexpected accelerators diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateLifecycleHooks(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    []LifecycleHook
+		wantErr bool
+	}{
+		{name: "no hooks"},
+		{
+			name:   "both hooks",
+			values: []string{"poststart=/bin/warmup --level=2", "prestop=/bin/drain"},
+			want: []LifecycleHook{
+				{Kind: "poststart", Command: "/bin/warmup --level=2"},
+				{Kind: "prestop", Command: "/bin/drain"},
+			},
+		},
+		{name: "unknown kind", values: []string{"preStart=/bin/x"}, wantErr: true},
+		{name: "no command", values: []string{"prestop="}, wantErr: true},
+		{name: "no separator", values: []string{"/bin/drain"}, wantErr: true},
+		{name: "duplicate kind", values: []string{"prestop=/bin/a", "prestop=/bin/b"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.LifecycleHookType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.LifecycleHooks, tc.want); diff != "" {
+				t.Errorf("unexpected lifecycle hooks diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateLayerDigests(t *testing.T) {
+	layers := []string{
+		"sha256:2b1d2f4b1a7c0c6e3f9a8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a",
+		"sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483",
+		"sha512:0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0",
+	}
+	testCases := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "multi-layer image", values: layers, want: layers},
+		{name: "missing algorithm", values: []string{layers[0], "781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483"}, wantErr: true},
+		{name: "invalid characters", values: []string{"sha256:781d/8dfdd"}, wantErr: true},
+		{name: "empty", values: []string{""}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.LayerDigestType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.LayerDigests, tc.want); diff != "" {
+				t.Errorf("unexpected layer digests diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateUlimits(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    []Ulimit
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{
+			name:   "multiple ulimits",
+			values: []string{"nofile=1024:4096", "memlock=65536"},
+			want:   []Ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}, {Name: "memlock", Soft: 65536, Hard: 65536}},
+		},
+		{name: "no limits", values: []string{"nofile"}, wantErr: true},
+		{name: "negative limit", values: []string{"nofile=-1"}, wantErr: true},
+		{name: "invalid hard limit", values: []string{"nofile=1024:max"}, wantErr: true},
+		{name: "soft above hard", values: []string{"nofile=4096:1024"}, wantErr: true},
+		{name: "invalid name", values: []string{"NOFILE=1024"}, wantErr: true},
+		{name: "duplicate name", values: []string{"nofile=1024", "nofile=2048"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.UlimitType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(state.ContainerExtensions.Ulimits, tc.want); diff != "" {
+				t.Errorf("unexpected ulimits diff: \n%v", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateArgsLimits(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ArgType, EventContent: []byte("/bin/app")},
+		{EventType: coscel.ArgType, EventContent: []byte("--a")},
+		{EventType: coscel.OverrideArgType, EventContent: []byte("--bb")},
+	}
+	testCases := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "unlimited"},
+		{name: "at limits", opts: Options{MaxArgsCount: 3, MaxArgsBytes: 15}},
+		{name: "too many args", opts: Options{MaxArgsCount: 2}, wantErr: "found 3 args, exceeding the maximum of 2"},
+		{name: "too many bytes", opts: Options{MaxArgsBytes: 14}, wantErr: "found 15 bytes of args, exceeding the maximum of 14"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), tc.opts)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("ExtractCOSState() returned error %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateDeriveImageDigest(t *testing.T) {
+	const otherDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	testCases := []struct {
+		name        string
+		events      []coscel.COSTLV
+		opts        Options
+		wantDigest  string
+		wantDerived bool
+	}{
+		{
+			name:        "digest in reference",
+			events:      []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/app@" + testImageDigest)}},
+			opts:        Options{DeriveImageDigest: true},
+			wantDigest:  testImageDigest,
+			wantDerived: true,
+		},
+		{
+			name:   "reference without digest",
+			events: []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/app:latest")}},
+			opts:   Options{DeriveImageDigest: true},
+		},
+		{
+			name: "measured digest kept",
+			events: []coscel.COSTLV{
+				{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/app@" + otherDigest)},
+				{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+			},
+			opts:       Options{DeriveImageDigest: true},
+			wantDigest: testImageDigest,
+		},
+		{
+			name:   "not derived without the option",
+			events: []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/app@" + testImageDigest)}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			state, sources, err := ExtractCOSStateWithSources(eventLog, uint8(cel.CCMRType), tc.opts)
+			if err != nil {
+				t.Fatalf("ExtractCOSStateWithSources() returned error: %v", err)
+			}
+			if got := state.GetContainer().GetImageDigest(); got != tc.wantDigest {
+				t.Errorf("ExtractCOSStateWithSources() got image digest %q, want %q", got, tc.wantDigest)
+			}
+			if got := state.ContainerExtensions.ImageDigestDerived; got != tc.wantDerived {
+				t.Errorf("ExtractCOSStateWithSources() got ImageDigestDerived %v, want %v", got, tc.wantDerived)
+			}
+			if recNum, ok := sources["Container.ImageDigest"]; tc.wantDerived && (!ok || recNum != 0) {
+				t.Errorf("ExtractCOSStateWithSources() got image digest source %d, %v, want the ImageRef record 0", recNum, ok)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateNonce(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "empty", values: []string{""}, wantErr: "found empty Nonce event"},
+		{name: "duplicate", values: []string{"\x01", "\x01"}, wantErr: "found more than one Nonce event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.NonceType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateSigner(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "empty", values: []string{""}, wantErr: "found empty Signer event"},
+		{name: "duplicate", values: []string{"projects/p/attestors/a", "projects/p/attestors/a"}, wantErr: "found duplicate Signer event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.SignerType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateExperimentalFeature(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "empty", values: []string{""}, wantErr: "found empty ExperimentalFeature event"},
+		{name: "duplicate", values: []string{"enable_gpu_cc", "enable_gpu_cc"}, wantErr: "found duplicate ExperimentalFeature event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.ExperimentalFeatureType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateSbomReference(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "empty", values: []string{""}, wantErr: "found empty SbomReference event"},
+		{name: "duplicate", values: []string{"a.sbom", "b.sbom"}, wantErr: "found more than one SbomReference event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.SbomReferenceType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateProvenanceReference(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "empty", values: []string{""}, wantErr: "found empty ProvenanceReference event"},
+		{name: "duplicate", values: []string{"a.att", "b.att"}, wantErr: "found more than one ProvenanceReference event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.ProvenanceReferenceType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateSourceRevision(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "empty", values: []string{""}, wantErr: "malformed SourceRevision event"},
+		{name: "abbreviated", values: []string{"3f2a9c1"}, wantErr: "malformed SourceRevision event"},
+		{name: "uppercase", values: []string{"3F2A9C1D8E7B6A5F4E3D2C1B0A9F8E7D6C5B4A39"}, wantErr: "malformed SourceRevision event"},
+		{name: "duplicate", values: []string{"3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39", "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39"}, wantErr: "found more than one SourceRevision event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.SourceRevisionType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateNamespaceSharing(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		wantErr string
+	}{
+		{name: "no mode", values: []string{"pid"}, wantErr: "want <pid|ipc>=<host|private>"},
+		{name: "unknown mode", values: []string{"pid=shared"}, wantErr: "want <pid|ipc>=<host|private>"},
+		{name: "unknown namespace", values: []string{"net=host"}, wantErr: `unknown namespace "net"`},
+		{name: "duplicate", values: []string{"pid=host", "pid=private"}, wantErr: "found more than one NamespaceSharing event for the pid namespace"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.NamespaceSharingType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateRunAsUser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   []string
+		wantUser string
+		wantUID  *uint32
+		wantErr  string
+	}{
+		{name: "not recorded"},
+		{name: "root user", values: []string{"root"}, wantUser: "root"},
+		{name: "root UID", values: []string{"0"}, wantUser: "0", wantUID: ptr(uint32(0))},
+		{name: "root UID with group", values: []string{"0:1000"}, wantUser: "0:1000", wantUID: ptr(uint32(0))},
+		{name: "named user", values: []string{"nobody"}, wantUser: "nobody"},
+		{name: "UID", values: []string{"65532"}, wantUser: "65532", wantUID: ptr(uint32(65532))},
+		{name: "UID with root group", values: []string{"1000:0"}, wantUser: "1000:0", wantUID: ptr(uint32(1000))},
+		{name: "UID out of range", values: []string{"4294967296"}, wantUser: "4294967296"},
+		{name: "empty user", values: []string{":1000"}, wantErr: "malformed RunAsUser event"},
+		{name: "duplicate", values: []string{"1000", "1000"}, wantErr: "found more than one RunAsUser event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.RunAsUserType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if got := state.ContainerExtensions.RunAsUser; got != tc.wantUser {
+				t.Errorf("ExtractCOSState() got RunAsUser %q, want %q", got, tc.wantUser)
+			}
+			if diff := cmp.Diff(tc.wantUID, state.ContainerExtensions.RunAsUID); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected RunAsUID diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateConfigHash(t *testing.T) {
+	configHash := "sha256:" + strings.Repeat("0f", 32)
+	testCases := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr string
+	}{
+		{name: "not recorded"},
+		{name: "recorded", values: []string{configHash}, want: configHash},
+		{name: "malformed", values: []string{"not a digest"}, wantErr: "malformed ConfigHash event"},
+		{name: "duplicate", values: []string{configHash, configHash}, wantErr: "found more than one ConfigHash event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.ConfigHashType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if state.ConfigHash != tc.want {
+				t.Errorf("ExtractCOSState() got config hash %q, want %q", state.ConfigHash, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateImageCreated(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    time.Time
+		wantErr string
+	}{
+		{name: "not recorded"},
+		{name: "UTC", values: []string{"2024-05-20T08:30:00Z"}, want: time.Date(2024, 5, 20, 8, 30, 0, 0, time.UTC)},
+		{name: "with offset", values: []string{"2024-05-31T23:00:00-07:00"}, want: time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)},
+		{name: "malformed", values: []string{"June 1st 2024"}, wantErr: "malformed ImageCreated event"},
+		{name: "duplicate", values: []string{"2024-05-20T08:30:00Z", "2024-05-20T08:30:00Z"}, wantErr: "found more than one ImageCreated event"},
+		{name: "zero time", values: []string{"0001-01-01T00:00:00Z"}, wantErr: "found the zero time"},
+		{name: "zero time then duplicate", values: []string{"0001-01-01T00:00:00Z", "2024-05-20T08:30:00Z"}, wantErr: "found the zero time"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.ImageCreatedType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if got := state.ContainerExtensions.ImageCreated; !got.Equal(tc.want) {
+				t.Errorf("ExtractCOSState() got image creation time %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateTokenAudience(t *testing.T) {
+	const audience = "https://sts.googleapis.com"
+	testCases := []struct {
+		name    string
+		values  []string
+		want    map[string]struct{}
+		wantErr string
+	}{
+		{name: "not recorded"},
+		{name: "recorded", values: []string{audience}, want: map[string]struct{}{audience: {}}},
+		{
+			name:   "repeated",
+			values: []string{"https://example.com", audience, "https://example.com"},
+			want:   map[string]struct{}{audience: {}, "https://example.com": {}},
+		},
+		{name: "empty", values: []string{""}, wantErr: "found empty TokenAudience event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.TokenAudienceType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, state.TokenAudiences); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected token audiences diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+// DumpEventLog writes a line per record of the event log with its record
+// number, register, COS event type, content in hex and whether its digests
+// verified, for debugging malformed or tampered logs. Unlike extraction it
+// does not stop at the first invalid record: failures are reported inline.
+// Records whose register type differs from registerType are marked as such.
+// Records which are not COS TLVs are dumped with their raw content type.
+func DumpEventLog(w io.Writer, eventLog cel.CEL, registerType uint8) error {
+	for _, record := range eventLog.Records() {
+		eventType, content, digestErr := dumpRecord(record)
+		digestStatus := "verified"
+		if digestErr != nil {
+			digestStatus = fmt.Sprintf("FAILED (%v)", digestErr)
+		}
+		register := fmt.Sprintf("%s[%d]", registerName(record.IndexType), record.Index)
+		if uint8(record.IndexType) != registerType {
+			register += " (unexpected register type)"
+		}
+		if _, err := fmt.Fprintf(w, "record %d: %s type=%s content=%x digests=%s\n", record.RecNum, register, eventType, content, digestStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpRecord returns the event type name and the content of the record, and
+// the result of verifying its digests.
+func dumpRecord(record cel.Record) (string, []byte, error) {
+	if !coscel.IsCOSTLV(record.Content) {
+		var err error
+		if len(record.Digests) == 0 {
+			err = fmt.Errorf("CEL record %d has no digests", record.RecNum)
+		} else {
+			err = cel.VerifyDigests(tlvContent(record.Content), record.Digests)
+		}
+		return fmt.Sprintf("non-COS content type %d", record.Content.Type), record.Content.Value, err
+	}
+	cosTlv, err := coscel.ParseToCOSTLV(record.Content)
+	if err != nil {
+		return "malformed COS TLV", record.Content.Value, err
+	}
+	return coscel.EventTypeName(cosTlv.EventType), cosTlv.EventContent, verifyRecordDigests(cosTlv, record, Options{})
+}
+
+// registerName returns the name of the register type.
+func registerName(mrType cel.MRType) string {
+	switch mrType {
+	case cel.PCRType:
+		return "PCR"
+	case cel.CCMRType:
+		return "CCMR"
+	default:
+		return fmt.Sprintf("MRType(%d)", mrType)
+	}
+}
@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+func TestDumpEventLog(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("img")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	// Tamper with the Arg record; the following record must still be dumped.
+	eventLog.Records()[1].Digests[crypto.SHA384][0] ^= 0xff
+
+	var b strings.Builder
+	if err := DumpEventLog(&b, eventLog, uint8(cel.CCMRType)); err != nil {
+		t.Fatalf("DumpEventLog() returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []string{
+		"record 0: CCMR[4] type=ImageRef content=696d67 digests=verified",
+		"record 1: CCMR[4] type=Arg content=2d2d78 digests=FAILED (",
+		"record 2: CCMR[4] type=LaunchSeparator content= digests=verified",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("DumpEventLog() wrote %d lines, want %d:\n%s", len(lines), len(want), b.String())
+	}
+	for i := range want {
+		if !strings.HasPrefix(lines[i], want[i]) {
+			t.Errorf("DumpEventLog() line %d = %q, want prefix %q", i, lines[i], want[i])
+		}
+	}
+	if strings.Contains(lines[0], "FAILED") || strings.Contains(lines[2], "FAILED") {
+		t.Errorf("DumpEventLog() reported failures for untampered records:\n%s", b.String())
+	}
+}
+
+func TestDumpEventLogRegisterMismatchAndNonCOS(t *testing.T) {
+	eventLog := buildCEL(t, cel.PCRType, coscel.EventPCRIndex, []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("img")}})
+	foreignEvent, err := generateNonCOSCELEvent([]crypto.Hash{crypto.SHA384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eventLog.AppendEvent(foreignEvent, []crypto.Hash{crypto.SHA384}, coscel.EventPCRIndex, func(crypto.Hash, int, []byte) error { return nil }); err != nil {
+		t.Fatalf("AppendEvent() returned error: %v", err)
+	}
+
+	var b strings.Builder
+	if err := DumpEventLog(&b, eventLog, uint8(cel.CCMRType)); err != nil {
+		t.Fatalf("DumpEventLog() returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []string{
+		"record 0: PCR[13] (unexpected register type) type=ImageRef content=696d67 digests=verified",
+		"record 1: PCR[13] (unexpected register type) type=non-COS content type 250 content=",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("DumpEventLog() wrote %d lines, want %d:\n%s", len(lines), len(want), b.String())
+	}
+	for i := range want {
+		if !strings.HasPrefix(lines[i], want[i]) {
+			t.Errorf("DumpEventLog() line %d = %q, want prefix %q", i, lines[i], want[i])
+		}
+	}
+	if !strings.HasSuffix(lines[1], "digests=verified") {
+		t.Errorf("DumpEventLog() line 1 = %q, want verified digests", lines[1])
+	}
+}
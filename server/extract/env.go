@@ -0,0 +1,99 @@
+package extract
+
+import (
+	"maps"
+	"slices"
+
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// Provenance describes where the value of an env var came from.
+type Provenance int
+
+const (
+	// ProvenanceBase is an env var only set by the launch template (image or
+	// launch spec), without an operator override.
+	ProvenanceBase Provenance = iota
+	// ProvenanceOverride is an env var only set by an operator override.
+	ProvenanceOverride
+	// ProvenanceOverrideChanged is an env var set by the launch template and
+	// overridden by the operator with a different value.
+	ProvenanceOverrideChanged
+	// ProvenanceOverrideUnchanged is an env var set by the launch template and
+	// overridden by the operator with the same value.
+	ProvenanceOverrideUnchanged
+)
+
+// String returns the name of the provenance.
+func (p Provenance) String() string {
+	switch p {
+	case ProvenanceBase:
+		return "Base"
+	case ProvenanceOverride:
+		return "Override"
+	case ProvenanceOverrideChanged:
+		return "OverrideChanged"
+	case ProvenanceOverrideUnchanged:
+		return "OverrideUnchanged"
+	default:
+		return "Unknown"
+	}
+}
+
+// EnvVarProvenance returns the provenance of every env var and overridden env
+// var of the container.
+func EnvVarProvenance(state *pb.AttestedCosState) map[string]Provenance {
+	envVars := state.GetContainer().GetEnvVars()
+	overridden := state.GetContainer().GetOverriddenEnvVars()
+
+	provenance := make(map[string]Provenance, len(envVars)+len(overridden))
+	for name := range envVars {
+		provenance[name] = ProvenanceBase
+	}
+	for name, value := range overridden {
+		base, ok := envVars[name]
+		switch {
+		case !ok:
+			provenance[name] = ProvenanceOverride
+		case base == value:
+			provenance[name] = ProvenanceOverrideUnchanged
+		default:
+			provenance[name] = ProvenanceOverrideChanged
+		}
+	}
+	return provenance
+}
+
+// EnvVarNames returns the sorted names of the env vars and overridden env vars
+// of the container, without their values, e.g. for audit logs which must not
+// contain secrets. A name set both ways is listed once.
+func EnvVarNames(state *pb.AttestedCosState) []string {
+	names := slices.Collect(maps.Keys(state.GetContainer().GetEnvVars()))
+	names = slices.AppendSeq(names, maps.Keys(state.GetContainer().GetOverriddenEnvVars()))
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// EffectiveEnviron returns the environment the container process ran with,
+// as sorted "KEY=VALUE" entries in the form of os.Environ. An overridden env
+// var replaces the env var of the same name.
+func EffectiveEnviron(state *pb.AttestedCosState) []string {
+	effective := effectiveEnvVars(state)
+	environ := make([]string, 0, len(effective))
+	for name, value := range effective {
+		environ = append(environ, name+"="+value)
+	}
+	slices.Sort(environ)
+	return environ
+}
+
+// effectiveEnvVars returns the env vars the container process ran with: the
+// env vars with the overridden env vars applied.
+func effectiveEnvVars(state *pb.AttestedCosState) map[string]string {
+	effective := maps.Clone(state.GetContainer().GetEnvVars())
+	if effective == nil {
+		effective = make(map[string]string)
+	}
+	maps.Copy(effective, state.GetContainer().GetOverriddenEnvVars())
+	return effective
+}
@@ -0,0 +1,88 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestEnvVarProvenance(t *testing.T) {
+	state := &pb.AttestedCosState{
+		Container: &pb.ContainerState{
+			EnvVars: map[string]string{
+				"base":      "value",
+				"changed":   "base",
+				"unchanged": "same",
+			},
+			OverriddenEnvVars: map[string]string{
+				"changed":   "override",
+				"unchanged": "same",
+				"override":  "value",
+			},
+		},
+	}
+	want := map[string]Provenance{
+		"base":      ProvenanceBase,
+		"changed":   ProvenanceOverrideChanged,
+		"unchanged": ProvenanceOverrideUnchanged,
+		"override":  ProvenanceOverride,
+	}
+	if diff := cmp.Diff(EnvVarProvenance(state), want); diff != "" {
+		t.Errorf("unexpected env var provenance diff: \n%v", diff)
+	}
+}
+
+func TestEnvVarProvenanceEmpty(t *testing.T) {
+	for _, state := range []*pb.AttestedCosState{nil, {}, {Container: &pb.ContainerState{}}} {
+		if got := EnvVarProvenance(state); len(got) != 0 {
+			t.Errorf("EnvVarProvenance(%v) = %v, want empty", state, got)
+		}
+	}
+}
+
+func TestEnvVarNames(t *testing.T) {
+	state := &pb.AttestedCosState{
+		Container: &pb.ContainerState{
+			EnvVars: map[string]string{
+				"ZONE":   "us-central1-a",
+				"API":    "secret-api-key",
+				"SHARED": "base",
+			},
+			OverriddenEnvVars: map[string]string{
+				"SHARED": "override",
+				"TOKEN":  "secret-token",
+			},
+		},
+	}
+	want := []string{"API", "SHARED", "TOKEN", "ZONE"}
+	if diff := cmp.Diff(EnvVarNames(state), want); diff != "" {
+		t.Errorf("unexpected env var names diff: \n%v", diff)
+	}
+	if got := EnvVarNames(&pb.AttestedCosState{}); len(got) != 0 {
+		t.Errorf("EnvVarNames() of an empty state = %v, want empty", got)
+	}
+}
+
+func TestEffectiveEnviron(t *testing.T) {
+	state := &pb.AttestedCosState{
+		Container: &pb.ContainerState{
+			EnvVars: map[string]string{
+				"ZONE":   "us-central1-a",
+				"SHARED": "base",
+				"EMPTY":  "",
+			},
+			OverriddenEnvVars: map[string]string{
+				"SHARED": "override",
+				"API":    "a=b",
+			},
+		},
+	}
+	want := []string{"API=a=b", "EMPTY=", "SHARED=override", "ZONE=us-central1-a"}
+	if diff := cmp.Diff(EffectiveEnviron(state), want); diff != "" {
+		t.Errorf("unexpected effective environ diff: \n%v", diff)
+	}
+	if got := EffectiveEnviron(&pb.AttestedCosState{}); len(got) != 0 {
+		t.Errorf("EffectiveEnviron() of an empty state = %v, want empty", got)
+	}
+}
@@ -0,0 +1,65 @@
+package extract
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTruncatedLog is returned when a raw COS event log ends in the middle of
+// a record, e.g. after a partial download, as opposed to a log which is
+// complete but malformed.
+var ErrTruncatedLog = errors.New("COS event log is truncated")
+
+const (
+	// celTLVHeaderLength is the length of the type and length fields of a
+	// CEL TLV.
+	celTLVHeaderLength = 5
+	// celRecordTLVs is the number of TLVs of a CEL record: the record number,
+	// the register index, the digests and the content.
+	celRecordTLVs = 4
+)
+
+// isTruncatedCEL reports whether the raw canonical event log ends in the
+// middle of a record, i.e. its last TLV is cut short or its last record has
+// fewer than celRecordTLVs TLVs.
+func isTruncatedCEL(raw []byte) bool {
+	tlvs := 0
+	for len(raw) > 0 {
+		if len(raw) < celTLVHeaderLength {
+			return true
+		}
+		valueLength := binary.BigEndian.Uint32(raw[1:celTLVHeaderLength])
+		if uint64(len(raw)-celTLVHeaderLength) < uint64(valueLength) {
+			return true
+		}
+		raw = raw[celTLVHeaderLength+int(valueLength):]
+		tlvs++
+	}
+	return tlvs%celRecordTLVs != 0
+}
+
+// MultiError aggregates several errors found while processing a COS event
+// log, so that all of them can be reported at once.
+type MultiError struct {
+	Errs []error
+}
+
+// Error lists every aggregated error, one per line.
+func (m *MultiError) Error() string {
+	if len(m.Errs) == 1 {
+		return m.Errs[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d errors occurred:", len(m.Errs))
+	for _, err := range m.Errs {
+		fmt.Fprintf(&b, "\n\t* %v", err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the aggregated errors, for use with errors.Is and errors.As.
+func (m *MultiError) Unwrap() []error {
+	return m.Errs
+}
@@ -0,0 +1,151 @@
+package extract
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-eventlog/register"
+)
+
+func TestMultiErrorFormatting(t *testing.T) {
+	testCases := []struct {
+		name string
+		errs []error
+		want string
+	}{
+		{
+			name: "single error",
+			errs: []error{errors.New("first")},
+			want: "first",
+		},
+		{
+			name: "multiple errors",
+			errs: []error{errors.New("first"), errors.New("second")},
+			want: "2 errors occurred:\n\t* first\n\t* second",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := &MultiError{Errs: tc.errs}
+			if got := err.Error(); got != tc.want {
+				t.Errorf("MultiError.Error() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMultiErrorUnwrap(t *testing.T) {
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+	var err error = &MultiError{Errs: []error{errFirst, errSecond}}
+
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Errorf("errors.Is() did not find the aggregated errors in %v", err)
+	}
+	if errors.Is(err, errors.New("first")) {
+		t.Errorf("errors.Is() matched an error that was not aggregated")
+	}
+	var multiErr *MultiError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("errors.As() did not find the *MultiError")
+	}
+	if len(multiErr.Unwrap()) != 2 {
+		t.Errorf("MultiError.Unwrap() returned %d errors, want 2", len(multiErr.Unwrap()))
+	}
+}
+
+func TestExtractCOSStateTolerant(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/other:latest")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("malformed")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.RestartPolicyType, EventContent: []byte("Sometimes")},
+		{EventType: coscel.LaunchSeparatorType},
+		{EventType: coscel.ArgType, EventContent: []byte("--after-separator")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	if _, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{}); err == nil {
+		t.Fatalf("ExtractCOSState() without Tolerant returned nil error, want error")
+	}
+
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{Tolerant: true})
+	var multiErr *MultiError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("ExtractCOSState() with Tolerant returned error %v, want *MultiError", err)
+	}
+	if len(multiErr.Errs) != 4 {
+		t.Errorf("ExtractCOSState() with Tolerant reported %d errors, want 4: %v", len(multiErr.Errs), err)
+	}
+	if state == nil {
+		t.Fatalf("ExtractCOSState() with Tolerant returned nil state")
+	}
+	if got := state.GetContainer().GetImageReference(); got != "docker.io/library/hello-world:latest" {
+		t.Errorf("ExtractCOSState() with Tolerant got image reference %q, want the first one", got)
+	}
+	if diff := cmp.Diff(state.GetContainer().GetArgs(), []string{"--x"}); diff != "" {
+		t.Errorf("unexpected args diff: \n%v", diff)
+	}
+
+	// Digest failures remain fatal in tolerant mode.
+	eventLog.Records()[3].Digests[crypto.SHA384][0] ^= 0xff
+	state, err = ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{Tolerant: true})
+	if err == nil || errors.As(err, &multiErr) || state != nil {
+		t.Errorf("ExtractCOSState() with Tolerant of a tampered log = %v, %v, want nil state and a fatal error", state, err)
+	}
+}
+
+func encodeCEL(t *testing.T, eventLog cel.CEL) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := eventLog.EncodeCEL(&buf); err != nil {
+		t.Fatalf("EncodeCEL() returned error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseCOSCELTruncatedLog(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	raw := encodeCEL(t, buildCEL(t, cel.PCRType, coscel.EventPCRIndex, events))
+	// The offset of the last record, and of its register index TLV after the
+	// 8 byte record number TLV.
+	lastRecord := len(encodeCEL(t, buildCEL(t, cel.PCRType, coscel.EventPCRIndex, events[:2])))
+	lastRecordIndex := lastRecord + celTLVHeaderLength + 8
+
+	corrupt := bytes.Clone(raw)
+	// Replace the type of the first record number TLV.
+	corrupt[0] = 0xff
+
+	testCases := []struct {
+		name          string
+		raw           []byte
+		wantTruncated bool
+	}{
+		{"truncated content", raw[:len(raw)-1], true},
+		{"truncated TLV header", raw[:lastRecord+2], true},
+		{"missing record TLVs", raw[:lastRecordIndex], true},
+		{"ends at record boundary", raw[:lastRecord], false},
+		{"corrupt complete log", corrupt, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseCOSCEL(tc.raw, register.PCRBank{}, Options{})
+			if err == nil {
+				t.Fatal("ParseCOSCEL() returned nil error, want error")
+			}
+			if got := errors.Is(err, ErrTruncatedLog); got != tc.wantTruncated {
+				t.Errorf("ParseCOSCEL() returned error %v, want ErrTruncatedLog: %v", err, tc.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package extract
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// Extractor extracts the COS state of event logs of one register type with
+// fixed options, validated once by NewExtractor. It is safe for concurrent
+// use, provided the callbacks of its options (EventHandlers, OnEvent and
+// DigestVerifier) are.
+type Extractor struct {
+	registerType uint8
+	opts         Options
+}
+
+// NewExtractor returns an Extractor for logs of registerType. The slices and
+// maps of opts are copied, so later changes by the caller do not affect the
+// Extractor.
+func NewExtractor(registerType uint8, opts Options) (*Extractor, error) {
+	if err := opts.checkRegisterTypes(); err != nil {
+		return nil, err
+	}
+	if opts.allowedIndices(cel.MRType(registerType)) == nil {
+		return nil, fmt.Errorf("unknown COS CEL log index type %d", registerType)
+	}
+	opts.AllowedPCRIndices = slices.Clone(opts.AllowedPCRIndices)
+	opts.AllowedCCMRIndices = slices.Clone(opts.AllowedCCMRIndices)
+	opts.RequiredDigestAlgs = slices.Clone(opts.RequiredDigestAlgs)
+	opts.VerifyDigestAlgs = slices.Clone(opts.VerifyDigestAlgs)
+	opts.AllowedEnvNames = slices.Clone(opts.AllowedEnvNames)
+	opts.ReservedEnvNames = slices.Clone(opts.ReservedEnvNames)
+	opts.EventHandlers = maps.Clone(opts.EventHandlers)
+	if opts.CustomRegisterTypes != nil {
+		customRegisterTypes := make(map[cel.MRType]RegisterType, len(opts.CustomRegisterTypes))
+		for mrType, custom := range opts.CustomRegisterTypes {
+			custom.AllowedIndices = slices.Clone(custom.AllowedIndices)
+			customRegisterTypes[mrType] = custom
+		}
+		opts.CustomRegisterTypes = customRegisterTypes
+	}
+	return &Extractor{registerType: registerType, opts: opts}, nil
+}
+
+// Extract returns the AttestedCosState of the event log, as VerifiedCOSState
+// does with the options of the Extractor.
+func (e *Extractor) Extract(eventLog cel.CEL) (*pb.AttestedCosState, error) {
+	return VerifiedCOSState(eventLog, e.registerType, e.opts)
+}
@@ -0,0 +1,95 @@
+package extract
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestExtractorConcurrent(t *testing.T) {
+	reserved := []string{"LAUNCHER_TOKEN"}
+	extractor, err := NewExtractor(uint8(cel.CCMRType), Options{ReservedEnvNames: reserved, RequireSeparator: true})
+	if err != nil {
+		t.Fatalf("NewExtractor() returned error: %v", err)
+	}
+	// Changing the options after construction must not affect the Extractor.
+	reserved[0] = "ZONE"
+
+	const logs = 16
+	eventLogs := make([]cel.CEL, logs)
+	for i := range eventLogs {
+		eventLogs[i] = buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+			{EventType: coscel.ImageRefType, EventContent: []byte(fmt.Sprintf("docker.io/library/app-%d:latest", i))},
+			{EventType: coscel.EnvVarType, EventContent: []byte("ZONE=us-central1-a")},
+			{EventType: coscel.LaunchSeparatorType},
+		})
+	}
+	want := make([]*COSState, logs)
+	for i, eventLog := range eventLogs {
+		if want[i], err = ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{RequireSeparator: true}); err != nil {
+			t.Fatalf("ExtractCOSState() returned error: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*logs)
+	for range 4 {
+		for i, eventLog := range eventLogs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				state, err := extractor.Extract(eventLog)
+				if err != nil {
+					errs <- fmt.Errorf("Extract() of log %d returned error: %v", i, err)
+					return
+				}
+				if diff := cmp.Diff(want[i].AttestedCosState, state, protocmp.Transform()); diff != "" {
+					errs <- fmt.Errorf("Extract() of log %d returned unexpected state diff: \n%v", i, diff)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestNewExtractorErrors(t *testing.T) {
+	if _, err := NewExtractor(uint8(hypotheticalMRType), Options{}); err == nil {
+		t.Error("NewExtractor() with an unknown register type returned nil error, want error")
+	}
+	opts := Options{CustomRegisterTypes: map[cel.MRType]RegisterType{hypotheticalMRType: {Name: "FMR"}}}
+	if _, err := NewExtractor(uint8(hypotheticalMRType), opts); err == nil {
+		t.Error("NewExtractor() with an invalid custom register type returned nil error, want error")
+	}
+}
+
+func TestNewExtractorCopiesCustomRegisterTypes(t *testing.T) {
+	allowed := []uint8{7}
+	extractor, err := NewExtractor(uint8(hypotheticalMRType), Options{CustomRegisterTypes: map[cel.MRType]RegisterType{
+		hypotheticalMRType: {Name: "FMR", AllowedIndices: allowed},
+	}})
+	if err != nil {
+		t.Fatalf("NewExtractor() returned error: %v", err)
+	}
+	// Changing the allowed indices after construction must not affect the
+	// Extractor.
+	allowed[0] = 8
+
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+	}
+	if _, err := extractor.Extract(buildCustomRegisterCEL(t, 7, events)); err != nil {
+		t.Errorf("Extract() of a log in index 7 returned error: %v", err)
+	}
+	if _, err := extractor.Extract(buildCustomRegisterCEL(t, 8, events)); err == nil {
+		t.Error("Extract() of a log in index 8 returned nil error, want error")
+	}
+}
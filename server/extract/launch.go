@@ -0,0 +1,83 @@
+package extract
+
+import (
+	"slices"
+
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// COSLaunch wraps an AttestedCosState with accessors for the launched
+// container, avoiding the nested proto getters.
+type COSLaunch struct {
+	state *pb.AttestedCosState
+}
+
+// NewCOSLaunch returns a COSLaunch wrapping state, as returned by
+// VerifiedCOSState.
+func NewCOSLaunch(state *pb.AttestedCosState) *COSLaunch {
+	return &COSLaunch{state: state}
+}
+
+// ExtractCOSLaunch extracts the AttestedCosState from the event log and
+// returns it as a COSLaunch.
+func ExtractCOSLaunch(eventLog cel.CEL, registerType uint8, opts Options) (*COSLaunch, error) {
+	state, err := VerifiedCOSState(eventLog, registerType, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewCOSLaunch(state), nil
+}
+
+// State returns the wrapped AttestedCosState.
+func (l *COSLaunch) State() *pb.AttestedCosState {
+	return l.state
+}
+
+// ImageReference returns the reference of the launched container image.
+func (l *COSLaunch) ImageReference() string {
+	return l.state.GetContainer().GetImageReference()
+}
+
+// ImageDigest returns the registry manifest digest of the container image.
+func (l *COSLaunch) ImageDigest() string {
+	return l.state.GetContainer().GetImageDigest()
+}
+
+// ImageID returns the local config digest of the container image.
+func (l *COSLaunch) ImageID() string {
+	return l.state.GetContainer().GetImageId()
+}
+
+// RestartPolicy returns the restart policy of the container.
+func (l *COSLaunch) RestartPolicy() pb.RestartPolicy {
+	return l.state.GetContainer().GetRestartPolicy()
+}
+
+// Args returns a copy of the container args, in launch order.
+func (l *COSLaunch) Args() []string {
+	return slices.Clone(l.state.GetContainer().GetArgs())
+}
+
+// OverriddenArgs returns a copy of the args overridden by the operator.
+func (l *COSLaunch) OverriddenArgs() []string {
+	return slices.Clone(l.state.GetContainer().GetOverriddenArgs())
+}
+
+// Env returns the value of the named container env var and whether it is set.
+func (l *COSLaunch) Env(name string) (string, bool) {
+	value, ok := l.state.GetContainer().GetEnvVars()[name]
+	return value, ok
+}
+
+// OverriddenEnv returns the value of the named env var overridden by the
+// operator and whether it was overridden.
+func (l *COSLaunch) OverriddenEnv(name string) (string, bool) {
+	value, ok := l.state.GetContainer().GetOverriddenEnvVars()[name]
+	return value, ok
+}
+
+// IsMemoryMonitored returns whether memory monitoring is enabled.
+func (l *COSLaunch) IsMemoryMonitored() bool {
+	return l.state.GetHealthMonitoring().GetMemoryEnabled()
+}
@@ -0,0 +1,93 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestCOSLaunch(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+		{EventType: coscel.RestartPolicyType, EventContent: []byte(pb.RestartPolicy_Never.String())},
+		{EventType: coscel.ImageIDType, EventContent: []byte(testImageID)},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.ArgType, EventContent: []byte("--y")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("foo=bar")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("empty=")},
+		{EventType: coscel.OverrideArgType, EventContent: []byte("--y")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("foo=bar")},
+		{EventType: coscel.MemoryMonitorType, EventContent: []byte{1}},
+	})
+	launch, err := ExtractCOSLaunch(eventLog, uint8(cel.CCMRType), Options{})
+	if err != nil {
+		t.Fatalf("ExtractCOSLaunch() returned error: %v", err)
+	}
+
+	if got := launch.ImageReference(); got != "docker.io/library/hello-world:latest" {
+		t.Errorf("ImageReference() = %q, want %q", got, "docker.io/library/hello-world:latest")
+	}
+	if got := launch.ImageDigest(); got != testImageDigest {
+		t.Errorf("ImageDigest() = %q, want %q", got, testImageDigest)
+	}
+	if got := launch.ImageID(); got != testImageID {
+		t.Errorf("ImageID() = %q, want %q", got, testImageID)
+	}
+	if got := launch.RestartPolicy(); got != pb.RestartPolicy_Never {
+		t.Errorf("RestartPolicy() = %v, want %v", got, pb.RestartPolicy_Never)
+	}
+	if diff := cmp.Diff(launch.Args(), []string{"--x", "--y"}); diff != "" {
+		t.Errorf("unexpected Args() diff: \n%v", diff)
+	}
+	if diff := cmp.Diff(launch.OverriddenArgs(), []string{"--y"}); diff != "" {
+		t.Errorf("unexpected OverriddenArgs() diff: \n%v", diff)
+	}
+	for _, tc := range []struct {
+		name      string
+		wantValue string
+		wantOK    bool
+	}{
+		{"foo", "bar", true},
+		{"empty", "", true},
+		{"unset", "", false},
+	} {
+		if value, ok := launch.Env(tc.name); value != tc.wantValue || ok != tc.wantOK {
+			t.Errorf("Env(%q) = %q, %v, want %q, %v", tc.name, value, ok, tc.wantValue, tc.wantOK)
+		}
+	}
+	if value, ok := launch.OverriddenEnv("foo"); value != "bar" || !ok {
+		t.Errorf("OverriddenEnv(%q) = %q, %v, want %q, true", "foo", value, ok, "bar")
+	}
+	if _, ok := launch.OverriddenEnv("empty"); ok {
+		t.Errorf("OverriddenEnv(%q) reported an override, want none", "empty")
+	}
+	if !launch.IsMemoryMonitored() {
+		t.Errorf("IsMemoryMonitored() = false, want true")
+	}
+
+	// Mutating the returned args must not change the launch.
+	launch.Args()[0] = "--mutated"
+	if got := launch.Args()[0]; got != "--x" {
+		t.Errorf("Args()[0] = %q after mutating a returned copy, want %q", got, "--x")
+	}
+}
+
+func TestCOSLaunchEmptyState(t *testing.T) {
+	launch := NewCOSLaunch(&pb.AttestedCosState{})
+	if got := launch.ImageReference(); got != "" {
+		t.Errorf("ImageReference() = %q, want empty", got)
+	}
+	if got := launch.Args(); len(got) != 0 {
+		t.Errorf("Args() = %v, want empty", got)
+	}
+	if _, ok := launch.Env("foo"); ok {
+		t.Errorf("Env(%q) reported a value, want none", "foo")
+	}
+	if launch.IsMemoryMonitored() {
+		t.Errorf("IsMemoryMonitored() = true, want false")
+	}
+}
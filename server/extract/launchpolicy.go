@@ -0,0 +1,88 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Launch policy keys of the LaunchPolicy event, matching the
+// tee.launch_policy image labels.
+const (
+	launchPolicyAllowCmdOverride = "allow_cmd_override"
+	launchPolicyAllowEnvOverride = "allow_env_override"
+)
+
+// LaunchPolicy is the launch policy of the image, recorded in the
+// LaunchPolicy event as entries of the form "<key>=<value>" separated by ';'.
+type LaunchPolicy struct {
+	// AllowCmdOverride is whether the operator may override the container
+	// args, from the "allow_cmd_override=<bool>" entry.
+	AllowCmdOverride bool
+	// AllowedEnvOverrides lists the env vars the operator may override, from
+	// the "allow_env_override=<name>[,<name>...]" entry.
+	AllowedEnvOverrides []string
+}
+
+// parseLaunchPolicy parses the LaunchPolicy event content. Omitted entries
+// keep their restrictive default.
+func parseLaunchPolicy(policy string) (LaunchPolicy, error) {
+	var p LaunchPolicy
+	if policy == "" {
+		return p, nil
+	}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(policy, ";") {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return LaunchPolicy{}, fmt.Errorf("malformed launch policy [%s], entry %q is not of the form <key>=<value>", policy, entry)
+		}
+		if seen[key] {
+			return LaunchPolicy{}, fmt.Errorf("malformed launch policy [%s], duplicate entry %q", policy, key)
+		}
+		seen[key] = true
+		switch key {
+		case launchPolicyAllowCmdOverride:
+			allow, err := strconv.ParseBool(value)
+			if err != nil {
+				return LaunchPolicy{}, fmt.Errorf("malformed launch policy [%s], invalid %s: %v", policy, key, err)
+			}
+			p.AllowCmdOverride = allow
+		case launchPolicyAllowEnvOverride:
+			if value != "" {
+				p.AllowedEnvOverrides = strings.Split(value, ",")
+			}
+		default:
+			return LaunchPolicy{}, fmt.Errorf("malformed launch policy [%s], unknown entry %q", policy, key)
+		}
+	}
+	return p, nil
+}
+
+// CheckOverridesAgainstPolicy returns an error if the operator overrides in
+// the state were not allowed by its launch policy. A state without a recorded
+// launch policy allows no overrides, as the launcher does by default. All
+// violations are reported.
+func CheckOverridesAgainstPolicy(state *COSState) error {
+	policy := state.LaunchPolicy
+	if policy == nil {
+		policy = &LaunchPolicy{}
+	}
+	var errs []error
+	if len(state.GetContainer().GetOverriddenArgs()) > 0 && !policy.AllowCmdOverride {
+		errs = append(errs, errors.New("found overridden args, but the launch policy does not allow cmd override"))
+	}
+	var disallowed []string
+	for name := range state.GetContainer().GetOverriddenEnvVars() {
+		if !slices.Contains(policy.AllowedEnvOverrides, name) {
+			disallowed = append(disallowed, name)
+		}
+	}
+	if len(disallowed) > 0 {
+		slices.Sort(disallowed)
+		errs = append(errs, fmt.Errorf("found overridden env vars not allowed by the launch policy: %v", disallowed))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestExtractCOSStateLaunchPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policies []string
+		want     *LaunchPolicy
+		wantErr  bool
+	}{
+		{name: "not recorded"},
+		{name: "empty policy", policies: []string{""}, want: &LaunchPolicy{}},
+		{name: "cmd override", policies: []string{"allow_cmd_override=true"}, want: &LaunchPolicy{AllowCmdOverride: true}},
+		{
+			name:     "full policy",
+			policies: []string{"allow_cmd_override=false;allow_env_override=FOO,BAR"},
+			want:     &LaunchPolicy{AllowedEnvOverrides: []string{"FOO", "BAR"}},
+		},
+		{name: "malformed entry", policies: []string{"allow_cmd_override"}, wantErr: true},
+		{name: "invalid bool", policies: []string{"allow_cmd_override=yes please"}, wantErr: true},
+		{name: "unknown entry", policies: []string{"log_redirect=always"}, wantErr: true},
+		{name: "duplicate entry", policies: []string{"allow_cmd_override=true;allow_cmd_override=false"}, wantErr: true},
+		{name: "duplicate event", policies: []string{"allow_cmd_override=true", "allow_cmd_override=true"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, policy := range tc.policies {
+				events = append(events, coscel.COSTLV{EventType: coscel.LaunchPolicyType, EventContent: []byte(policy)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want, state.LaunchPolicy); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected launch policy diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckOverridesAgainstPolicy(t *testing.T) {
+	testCases := []struct {
+		name         string
+		policy       *LaunchPolicy
+		overrideArgs []string
+		overrideEnv  map[string]string
+		wantErr      bool
+	}{
+		{name: "no overrides without policy"},
+		{name: "no overrides with restrictive policy", policy: &LaunchPolicy{}},
+		{name: "overrides without policy", overrideArgs: []string{"--x"}, wantErr: true},
+		{
+			name:         "policy allows overrides",
+			policy:       &LaunchPolicy{AllowCmdOverride: true, AllowedEnvOverrides: []string{"FOO"}},
+			overrideArgs: []string{"--x"},
+			overrideEnv:  map[string]string{"FOO": "bar"},
+		},
+		{
+			name:         "policy forbids cmd override",
+			policy:       &LaunchPolicy{AllowedEnvOverrides: []string{"FOO"}},
+			overrideArgs: []string{"--x"},
+			wantErr:      true,
+		},
+		{
+			name:        "policy forbids env override",
+			policy:      &LaunchPolicy{AllowCmdOverride: true, AllowedEnvOverrides: []string{"FOO"}},
+			overrideEnv: map[string]string{"FOO": "bar", "BAR": "baz"},
+			wantErr:     true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{
+				AttestedCosState: &pb.AttestedCosState{
+					Container: &pb.ContainerState{
+						OverriddenArgs:    tc.overrideArgs,
+						OverriddenEnvVars: tc.overrideEnv,
+					},
+				},
+				LaunchPolicy: tc.policy,
+			}
+			err := CheckOverridesAgainstPolicy(state)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("CheckOverridesAgainstPolicy() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// MarshalDeterministic serializes the state with deterministic protobuf
+// marshaling, which orders map entries (the env vars) by key. The output is
+// stable across calls within a build, so it can be stored and compared
+// byte-wise. It is not guaranteed stable across protobuf library versions.
+func MarshalDeterministic(state *pb.AttestedCosState) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(state)
+}
+
+// stableCOSState is the JSON shape written by MarshalCOSStateJSONStable.
+type stableCOSState struct {
+	Container        stableContainer `json:"container"`
+	CosVersion       string          `json:"cos_version"`
+	LauncherVersion  string          `json:"launcher_version"`
+	MemoryMonitoring *bool           `json:"memory_monitoring"`
+	GpuCCMode        string          `json:"gpu_cc_mode"`
+}
+
+type stableContainer struct {
+	ImageReference    string         `json:"image_reference"`
+	ImageDigest       string         `json:"image_digest"`
+	ImageID           string         `json:"image_id"`
+	RestartPolicy     string         `json:"restart_policy"`
+	Args              []string       `json:"args"`
+	OverriddenArgs    []string       `json:"overridden_args"`
+	EnvVars           []stableEnvVar `json:"env_vars"`
+	OverriddenEnvVars []stableEnvVar `json:"overridden_env_vars"`
+}
+
+type stableEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// MarshalCOSStateJSONStable serializes the state as JSON of a fixed shape,
+// independent of the proto field names and of protojson, for validation
+// against a JSON Schema downstream:
+//
+//	{
+//	  "container": {
+//	    "image_reference": string,
+//	    "image_digest": string,
+//	    "image_id": string,
+//	    "restart_policy": string,  // pb.RestartPolicy name, e.g. "Always"
+//	    "args": [string],
+//	    "overridden_args": [string],
+//	    "env_vars": [{"name": string, "value": string}],  // sorted by name
+//	    "overridden_env_vars": [{"name": string, "value": string}]
+//	  },
+//	  "cos_version": string,       // "major.minor.patch", "" if unset
+//	  "launcher_version": string,  // "major.minor.patch", "" if unset
+//	  "memory_monitoring": bool or null,
+//	  "gpu_cc_mode": string        // pb.GPUDeviceCCMode name
+//	}
+//
+// Every field is always present, and lists are empty rather than null. The
+// GPU attestation report is not included.
+func MarshalCOSStateJSONStable(state *pb.AttestedCosState) ([]byte, error) {
+	container := state.GetContainer()
+	var memoryMonitoring *bool
+	if healthMonitoring := state.GetHealthMonitoring(); healthMonitoring != nil {
+		memoryMonitoring = healthMonitoring.MemoryEnabled
+	}
+	stable := stableCOSState{
+		Container: stableContainer{
+			ImageReference:    container.GetImageReference(),
+			ImageDigest:       container.GetImageDigest(),
+			ImageID:           container.GetImageId(),
+			RestartPolicy:     container.GetRestartPolicy().String(),
+			Args:              append([]string{}, container.GetArgs()...),
+			OverriddenArgs:    append([]string{}, container.GetOverriddenArgs()...),
+			EnvVars:           stableEnvVars(container.GetEnvVars()),
+			OverriddenEnvVars: stableEnvVars(container.GetOverriddenEnvVars()),
+		},
+		CosVersion:       stableVersion(state.GetCosVersion()),
+		LauncherVersion:  stableVersion(state.GetLauncherVersion()),
+		MemoryMonitoring: memoryMonitoring,
+		GpuCCMode:        state.GetGpuDeviceState().GetCcMode().String(),
+	}
+	return json.Marshal(stable)
+}
+
+// stableEnvVars returns the env vars as name/value objects sorted by name.
+func stableEnvVars(envVars map[string]string) []stableEnvVar {
+	stable := make([]stableEnvVar, 0, len(envVars))
+	for _, name := range slices.Sorted(maps.Keys(envVars)) {
+		stable = append(stable, stableEnvVar{Name: name, Value: envVars[name]})
+	}
+	return stable
+}
+
+// stableVersion formats the version as "major.minor.patch", or "" if nil.
+func stableVersion(version *pb.SemanticVersion) string {
+	if version == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d.%d", version.GetMajor(), version.GetMinor(), version.GetPatch())
+}
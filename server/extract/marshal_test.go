@@ -0,0 +1,98 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestMarshalDeterministic(t *testing.T) {
+	newState := func(order []int) *pb.AttestedCosState {
+		envVars := make(map[string]string)
+		overridden := make(map[string]string)
+		for _, i := range order {
+			envVars[fmt.Sprintf("ENV_%d", i)] = fmt.Sprintf("value%d", i)
+			overridden[fmt.Sprintf("OVERRIDE_%d", i)] = fmt.Sprintf("value%d", i)
+		}
+		return &pb.AttestedCosState{
+			Container: &pb.ContainerState{
+				ImageReference:    "docker.io/library/hello-world:latest",
+				Args:              []string{"--x", "--y"},
+				EnvVars:           envVars,
+				OverriddenEnvVars: overridden,
+			},
+		}
+	}
+	var forward, backward []int
+	for i := 0; i < 50; i++ {
+		forward = append(forward, i)
+		backward = append(backward, 49-i)
+	}
+
+	want, err := MarshalDeterministic(newState(forward))
+	if err != nil {
+		t.Fatalf("MarshalDeterministic() returned error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		for _, order := range [][]int{forward, backward} {
+			got, err := MarshalDeterministic(newState(order))
+			if err != nil {
+				t.Fatalf("MarshalDeterministic() returned error: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("MarshalDeterministic() output differs between runs")
+			}
+		}
+	}
+
+	roundTripped := &pb.AttestedCosState{}
+	if err := proto.Unmarshal(want, roundTripped); err != nil {
+		t.Fatalf("proto.Unmarshal() returned error: %v", err)
+	}
+	if !proto.Equal(roundTripped, newState(forward)) {
+		t.Errorf("MarshalDeterministic() output does not round trip")
+	}
+}
+
+func TestMarshalCOSStateJSONStable(t *testing.T) {
+	enabled := true
+	state := &pb.AttestedCosState{
+		Container: &pb.ContainerState{
+			ImageReference:    "docker.io/library/hello-world:latest",
+			ImageDigest:       "sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483",
+			RestartPolicy:     pb.RestartPolicy_OnFailure,
+			Args:              []string{"--x"},
+			EnvVars:           map[string]string{"ZONE": "us-central1-a", "API": "key"},
+			OverriddenEnvVars: map[string]string{"ZONE": "us-east1-b"},
+		},
+		CosVersion:       &pb.SemanticVersion{Major: 113, Minor: 18244, Patch: 85},
+		HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &enabled},
+	}
+	want := `{"container":{"image_reference":"docker.io/library/hello-world:latest",` +
+		`"image_digest":"sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483",` +
+		`"image_id":"","restart_policy":"OnFailure","args":["--x"],"overridden_args":[],` +
+		`"env_vars":[{"name":"API","value":"key"},{"name":"ZONE","value":"us-central1-a"}],` +
+		`"overridden_env_vars":[{"name":"ZONE","value":"us-east1-b"}]},` +
+		`"cos_version":"113.18244.85","launcher_version":"","memory_monitoring":true,"gpu_cc_mode":"UNSET"}`
+	got, err := MarshalCOSStateJSONStable(state)
+	if err != nil {
+		t.Fatalf("MarshalCOSStateJSONStable() returned error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("MarshalCOSStateJSONStable() = %s, want %s", got, want)
+	}
+
+	wantEmpty := `{"container":{"image_reference":"","image_digest":"","image_id":"","restart_policy":"Always",` +
+		`"args":[],"overridden_args":[],"env_vars":[],"overridden_env_vars":[]},` +
+		`"cos_version":"","launcher_version":"","memory_monitoring":null,"gpu_cc_mode":"UNSET"}`
+	got, err = MarshalCOSStateJSONStable(&pb.AttestedCosState{})
+	if err != nil {
+		t.Fatalf("MarshalCOSStateJSONStable() of an empty state returned error: %v", err)
+	}
+	if string(got) != wantEmpty {
+		t.Errorf("MarshalCOSStateJSONStable() of an empty state = %s, want %s", got, wantEmpty)
+	}
+}
@@ -0,0 +1,187 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// digestRegexp matches an OCI content digest of the form algorithm:encoded.
+var digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// referenceDigest returns the digest of an image reference pinned by digest
+// (e.g. repo@sha256:abc...), and whether the reference is pinned.
+func referenceDigest(imageReference string) (string, bool) {
+	_, digest, ok := strings.Cut(imageReference, "@")
+	if !ok || !digestRegexp.MatchString(digest) {
+		return "", false
+	}
+	return digest, true
+}
+
+// RequireDigestPinned returns an error if the container image was not
+// referenced by digest, i.e. the image reference only names a mutable tag, or
+// if the image digest was not measured.
+func RequireDigestPinned(state *pb.ContainerState) error {
+	if state.GetImageDigest() == "" {
+		return errors.New("image digest is empty")
+	}
+	if _, ok := referenceDigest(state.GetImageReference()); !ok {
+		return fmt.Errorf("image reference %q is not pinned by digest", state.GetImageReference())
+	}
+	return nil
+}
+
+// VerifyImageInAllowlist extracts the COS state from the event log and checks
+// the container image digest is one of the allowed digests. The error reports
+// the extracted digest if it is not allowed.
+func VerifyImageInAllowlist(eventLog cel.CEL, registerType uint8, allowed []string) error {
+	state, err := VerifiedCOSState(eventLog, registerType, Options{})
+	if err != nil {
+		return err
+	}
+	imageDigest := state.GetContainer().GetImageDigest()
+	if imageDigest == "" {
+		return errors.New("image digest is empty")
+	}
+	if !slices.Contains(allowed, imageDigest) {
+		return fmt.Errorf("image digest %q is not in the allowlist", imageDigest)
+	}
+	return nil
+}
+
+// VerifyDigestConsistency extracts the COS state from the event log and
+// checks the container image digest equals the digest reported separately,
+// e.g. by the attestation, so a verifier can rely on either.
+func VerifyDigestConsistency(eventLog cel.CEL, registerType uint8, reportedDigest string) error {
+	state, err := VerifiedCOSState(eventLog, registerType, Options{})
+	if err != nil {
+		return err
+	}
+	imageDigest := state.GetContainer().GetImageDigest()
+	if imageDigest == "" {
+		return errors.New("image digest is empty")
+	}
+	if imageDigest != reportedDigest {
+		return fmt.Errorf("image digest %q does not match the reported digest %q", imageDigest, reportedDigest)
+	}
+	return nil
+}
+
+// DenyImageDigests returns an Options.OnEvent callback failing as soon as an
+// ImageDigest event with one of the denied digests is seen, so deny-listed
+// images are rejected without processing the rest of the log.
+func DenyImageDigests(denied []string) func(coscel.COSTLV) error {
+	return func(cosTlv coscel.COSTLV) error {
+		if cosTlv.EventType != coscel.ImageDigestType {
+			return nil
+		}
+		if digest := string(cosTlv.EventContent); slices.Contains(denied, digest) {
+			return fmt.Errorf("image digest %q is deny-listed", digest)
+		}
+		return nil
+	}
+}
+
+// Policy is a set of requirements on an extracted COS state, checked by
+// Evaluate. The zero Policy accepts every state.
+type Policy struct {
+	// RequiredEnvVars maps env var names to the value they must have, both in
+	// the env vars and in the effective env vars the container ran with,
+	// i.e. after operator overrides are applied.
+	RequiredEnvVars map[string]string
+	// AllowedRestartPolicies lists the restart policies the container may
+	// run with, e.g. only Never for batch jobs. Any policy is allowed if
+	// empty.
+	AllowedRestartPolicies []pb.RestartPolicy
+}
+
+// VerifyReport is the result of evaluating a COS event log against a Policy.
+type VerifyReport struct {
+	// Passed is whether the state satisfies the policy.
+	Passed bool
+	// Reasons lists every policy violation, empty if Passed.
+	Reasons []string
+	// State is the state extracted from the log.
+	State *COSState
+}
+
+// EvaluateRawLog decodes a raw canonical COS event log, extracts its state and
+// evaluates it against the policy, treating a nil policy as the zero Policy.
+// Policy violations are reported in the VerifyReport; an error is only
+// returned if the log cannot be decoded or extracted. The log is not replayed
+// against any register, so callers must verify it is bound to a quoted
+// register, e.g. with ReplayAndVerify, before trusting the report.
+func EvaluateRawLog(raw []byte, registerType uint8, policy *Policy) (*VerifyReport, error) {
+	eventLog, err := decodeCOSCEL(raw)
+	if err != nil {
+		return nil, err
+	}
+	state, err := ExtractCOSState(eventLog, registerType, Options{})
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		policy = &Policy{}
+	}
+	report := &VerifyReport{Passed: true, State: state}
+	if err := policy.Evaluate(state); err != nil {
+		report.Passed = false
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, violation := range joined.Unwrap() {
+				report.Reasons = append(report.Reasons, violation.Error())
+			}
+		} else {
+			report.Reasons = []string{err.Error()}
+		}
+	}
+	return report, nil
+}
+
+// Evaluate checks the state against the policy. All violations are returned
+// together.
+func (p Policy) Evaluate(state *COSState) error {
+	var errs []error
+	errs = append(errs, p.checkRequiredEnvVars(state)...)
+	if err := p.checkRestartPolicy(state); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (p Policy) checkRestartPolicy(state *COSState) error {
+	policy := state.GetContainer().GetRestartPolicy()
+	if len(p.AllowedRestartPolicies) == 0 || slices.Contains(p.AllowedRestartPolicies, policy) {
+		return nil
+	}
+	return fmt.Errorf("restart policy %v is not in the allowed policies %v", policy, p.AllowedRestartPolicies)
+}
+
+func (p Policy) checkRequiredEnvVars(state *COSState) []error {
+	base := state.GetContainer().GetEnvVars()
+	effective := effectiveEnvVars(state.AttestedCosState)
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(p.RequiredEnvVars)) {
+		want := p.RequiredEnvVars[name]
+		for _, envVars := range []struct {
+			kind   string
+			values map[string]string
+		}{{"env var", base}, {"effective env var", effective}} {
+			got, ok := envVars.values[name]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("required %s %s is not set, want %q", envVars.kind, name, want))
+			case got != want:
+				errs = append(errs, fmt.Errorf("required %s %s is %q, want %q", envVars.kind, name, got, want))
+			}
+		}
+	}
+	return errs
+}
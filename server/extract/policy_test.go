@@ -0,0 +1,343 @@
+package extract
+
+import (
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+const (
+	testImageDigest = "sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483"
+	testImageID     = "sha256:5DF4A1AC347DCF8CF5E9D0ABC04B04DB847D1B88D3B1CC1006F0ACB68E5A1F4B"
+)
+
+func TestRequireDigestPinned(t *testing.T) {
+	testCases := []struct {
+		name    string
+		state   *pb.ContainerState
+		wantErr bool
+	}{
+		{
+			name:  "digest-pinned",
+			state: &pb.ContainerState{ImageReference: "docker.io/library/hello-world@" + testImageDigest, ImageDigest: testImageDigest},
+		},
+		{
+			name:  "tag and digest",
+			state: &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest@" + testImageDigest, ImageDigest: testImageDigest},
+		},
+		{
+			name:    "tag only",
+			state:   &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest", ImageDigest: testImageDigest},
+			wantErr: true,
+		},
+		{
+			name:    "no tag or digest",
+			state:   &pb.ContainerState{ImageReference: "docker.io/library/hello-world", ImageDigest: testImageDigest},
+			wantErr: true,
+		},
+		{
+			name:    "malformed digest",
+			state:   &pb.ContainerState{ImageReference: "docker.io/library/hello-world@latest", ImageDigest: testImageDigest},
+			wantErr: true,
+		},
+		{
+			name:    "empty image digest",
+			state:   &pb.ContainerState{ImageReference: "docker.io/library/hello-world@" + testImageDigest},
+			wantErr: true,
+		},
+		{
+			name:    "empty state",
+			state:   &pb.ContainerState{},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := RequireDigestPinned(tc.state)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("RequireDigestPinned() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyImageInAllowlist(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+	})
+	const otherDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	if err := VerifyImageInAllowlist(eventLog, uint8(cel.CCMRType), []string{otherDigest, testImageDigest}); err != nil {
+		t.Errorf("VerifyImageInAllowlist() with an allowed digest returned error: %v", err)
+	}
+	for _, allowed := range [][]string{nil, {otherDigest}} {
+		err := VerifyImageInAllowlist(eventLog, uint8(cel.CCMRType), allowed)
+		if err == nil {
+			t.Fatalf("VerifyImageInAllowlist(%v) returned nil error, want error", allowed)
+		}
+		if !strings.Contains(err.Error(), testImageDigest) {
+			t.Errorf("VerifyImageInAllowlist(%v) error %q does not contain the extracted digest", allowed, err)
+		}
+	}
+
+	noDigest := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+	})
+	if err := VerifyImageInAllowlist(noDigest, uint8(cel.CCMRType), []string{""}); err == nil {
+		t.Errorf("VerifyImageInAllowlist() of a log without image digest returned nil error, want error")
+	}
+
+	if err := VerifyImageInAllowlist(eventLog, uint8(cel.PCRType), []string{testImageDigest}); err == nil {
+		t.Errorf("VerifyImageInAllowlist() with the wrong register type returned nil error, want error")
+	}
+}
+
+func TestVerifyDigestConsistency(t *testing.T) {
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+	})
+	noDigest := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/hello-world:latest")},
+	})
+	testCases := []struct {
+		name     string
+		eventLog cel.CEL
+		reported string
+		wantErr  bool
+	}{
+		{name: "matching", eventLog: eventLog, reported: testImageDigest},
+		{name: "mismatching", eventLog: eventLog, reported: "sha256:0000000000000000000000000000000000000000000000000000000000000000", wantErr: true},
+		{name: "not reported", eventLog: eventLog, wantErr: true},
+		{name: "not measured", eventLog: noDigest, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyDigestConsistency(tc.eventLog, uint8(cel.CCMRType), tc.reported)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("VerifyDigestConsistency() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateRequiredEnvVars(t *testing.T) {
+	policy := Policy{RequiredEnvVars: map[string]string{
+		"ENVIRONMENT": "production",
+		"REGION":      "us",
+	}}
+	testCases := []struct {
+		name           string
+		envVars        map[string]string
+		overridden     map[string]string
+		wantViolations []string
+	}{
+		{
+			name:    "matching",
+			envVars: map[string]string{"ENVIRONMENT": "production", "REGION": "us", "OTHER": "x"},
+		},
+		{
+			name:       "matching override",
+			envVars:    map[string]string{"ENVIRONMENT": "production", "REGION": "us"},
+			overridden: map[string]string{"REGION": "us"},
+		},
+		{
+			name:           "missing",
+			envVars:        map[string]string{"ENVIRONMENT": "production"},
+			wantViolations: []string{"env var REGION is not set", "effective env var REGION is not set"},
+		},
+		{
+			name:           "wrong value",
+			envVars:        map[string]string{"ENVIRONMENT": "staging", "REGION": "eu"},
+			wantViolations: []string{`env var ENVIRONMENT is "staging"`, `effective env var ENVIRONMENT is "staging"`, `env var REGION is "eu"`, `effective env var REGION is "eu"`},
+		},
+		{
+			name:           "overridden to wrong value",
+			envVars:        map[string]string{"ENVIRONMENT": "production", "REGION": "us"},
+			overridden:     map[string]string{"ENVIRONMENT": "staging"},
+			wantViolations: []string{`effective env var ENVIRONMENT is "staging"`},
+		},
+		{
+			name:           "only set by override",
+			envVars:        map[string]string{"REGION": "us"},
+			overridden:     map[string]string{"ENVIRONMENT": "production"},
+			wantViolations: []string{"env var ENVIRONMENT is not set"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{AttestedCosState: &pb.AttestedCosState{
+				Container: &pb.ContainerState{EnvVars: tc.envVars, OverriddenEnvVars: tc.overridden},
+			}}
+			err := policy.Evaluate(state)
+			if len(tc.wantViolations) == 0 {
+				if err != nil {
+					t.Errorf("Evaluate() returned error %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Evaluate() returned nil error, want violations %v", tc.wantViolations)
+			}
+			violations := err.(interface{ Unwrap() []error }).Unwrap()
+			if len(violations) != len(tc.wantViolations) {
+				t.Fatalf("Evaluate() returned %d violations (%v), want %d", len(violations), err, len(tc.wantViolations))
+			}
+			for i, want := range tc.wantViolations {
+				if !strings.HasPrefix(violations[i].Error(), "required "+want) {
+					t.Errorf("Evaluate() violation %d = %q, want prefix %q", i, violations[i], "required "+want)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateAllowedRestartPolicies(t *testing.T) {
+	testCases := []struct {
+		name    string
+		allowed []pb.RestartPolicy
+		policy  pb.RestartPolicy
+		wantErr bool
+	}{
+		{name: "no restriction", policy: pb.RestartPolicy_Always},
+		{name: "allowed", allowed: []pb.RestartPolicy{pb.RestartPolicy_Never}, policy: pb.RestartPolicy_Never},
+		{name: "one of several allowed", allowed: []pb.RestartPolicy{pb.RestartPolicy_Never, pb.RestartPolicy_OnFailure}, policy: pb.RestartPolicy_OnFailure},
+		{name: "disallowed", allowed: []pb.RestartPolicy{pb.RestartPolicy_Never}, policy: pb.RestartPolicy_Always, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{AttestedCosState: &pb.AttestedCosState{
+				Container: &pb.ContainerState{RestartPolicy: tc.policy},
+			}}
+			err := Policy{AllowedRestartPolicies: tc.allowed}.Evaluate(state)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Evaluate() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateZeroPolicy(t *testing.T) {
+	state := &COSState{AttestedCosState: &pb.AttestedCosState{}}
+	if err := (Policy{}).Evaluate(state); err != nil {
+		t.Errorf("Evaluate() with the zero Policy returned error %v, want nil", err)
+	}
+}
+
+func TestEvaluateRawLog(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a@" + testImageDigest)},
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+		{EventType: coscel.EnvVarType, EventContent: []byte("ENVIRONMENT=production")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("REGION=eu")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	raw := encodeCEL(t, buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events))
+
+	testCases := []struct {
+		name        string
+		policy      *Policy
+		wantPassed  bool
+		wantReasons int
+	}{
+		{name: "nil policy", wantPassed: true},
+		{name: "satisfied policy", policy: &Policy{RequiredEnvVars: map[string]string{"ENVIRONMENT": "production"}}, wantPassed: true},
+		{
+			name:        "violated policy",
+			policy:      &Policy{RequiredEnvVars: map[string]string{"ENVIRONMENT": "staging", "REGION": "us"}},
+			wantReasons: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := EvaluateRawLog(raw, uint8(cel.CCMRType), tc.policy)
+			if err != nil {
+				t.Fatalf("EvaluateRawLog() returned error: %v", err)
+			}
+			if report.Passed != tc.wantPassed {
+				t.Errorf("EvaluateRawLog() got Passed %v, want %v (reasons: %v)", report.Passed, tc.wantPassed, report.Reasons)
+			}
+			if len(report.Reasons) != tc.wantReasons {
+				t.Errorf("EvaluateRawLog() got %d reasons %v, want %d", len(report.Reasons), report.Reasons, tc.wantReasons)
+			}
+			if got := report.State.GetContainer().GetImageDigest(); got != testImageDigest {
+				t.Errorf("EvaluateRawLog() got image digest %q, want %q", got, testImageDigest)
+			}
+		})
+	}
+}
+
+func TestEvaluateRawLogInvalidLog(t *testing.T) {
+	events := []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")}}
+	raw := encodeCEL(t, buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events))
+
+	if _, err := EvaluateRawLog(raw[:len(raw)-1], uint8(cel.CCMRType), &Policy{}); !errors.Is(err, ErrTruncatedLog) {
+		t.Errorf("EvaluateRawLog() of a truncated log returned error %v, want ErrTruncatedLog", err)
+	}
+	if _, err := EvaluateRawLog(raw, uint8(cel.PCRType), &Policy{}); err == nil {
+		t.Error("EvaluateRawLog() with the wrong register type returned nil error, want error")
+	}
+}
+
+func TestDenyImageDigests(t *testing.T) {
+	const deniedDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	testCases := []struct {
+		name    string
+		digest  string
+		wantErr bool
+	}{
+		{"allowed digest", testImageDigest, false},
+		{"denied digest", deniedDigest, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := []coscel.COSTLV{
+				{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")},
+				{EventType: coscel.ImageDigestType, EventContent: []byte(tc.digest)},
+				{EventType: coscel.ArgType, EventContent: []byte("--x")},
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			_, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{OnEvent: DenyImageDigests([]string{deniedDigest})})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDenyImageDigestsAbortsEarly(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.ArgType, EventContent: []byte("--y")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	// Tamper with a later record, which fails the extraction if processed.
+	eventLog.Records()[2].Digests[crypto.SHA384][0] ^= 0xff
+
+	deny := DenyImageDigests([]string{testImageDigest})
+	var seen int
+	opts := Options{
+		Tolerant: true,
+		OnEvent: func(cosTlv coscel.COSTLV) error {
+			seen++
+			return deny(cosTlv)
+		},
+	}
+	state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), opts)
+	if err == nil || !strings.Contains(err.Error(), "deny-listed") {
+		t.Fatalf("ExtractCOSState() returned error %v, want the deny-list error", err)
+	}
+	if state != nil {
+		t.Errorf("ExtractCOSState() returned state %v, want nil", state)
+	}
+	if seen != 1 {
+		t.Errorf("ExtractCOSState() called OnEvent %d times, want 1", seen)
+	}
+}
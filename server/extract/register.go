@@ -0,0 +1,37 @@
+package extract
+
+import (
+	"fmt"
+
+	"github.com/google/go-eventlog/cel"
+)
+
+// RegisterType describes a custom register type COS events may be measured
+// into. See Options.CustomRegisterTypes.
+type RegisterType struct {
+	// Name is the name of the register type used in errors, e.g. "RTMR".
+	Name string
+	// AllowedIndices lists the register indices COS events are expected in.
+	// It must not be empty.
+	AllowedIndices []uint8
+	// ValidateRecord, if set, is called with every COS record of the type
+	// after its index is checked and before its content is parsed, for
+	// checks specific to the platform. Returning an error fails extraction.
+	ValidateRecord func(record cel.Record) error
+}
+
+// checkRegisterTypes returns an error if a custom register type of opts is
+// invalid or redefines a built-in type.
+func (opts Options) checkRegisterTypes() error {
+	for mrType, registerType := range opts.CustomRegisterTypes {
+		switch {
+		case mrType == cel.PCRType || mrType == cel.CCMRType:
+			return fmt.Errorf("custom register type %d redefines a built-in register type", mrType)
+		case registerType.Name == "":
+			return fmt.Errorf("custom register type %d has no name", mrType)
+		case len(registerType.AllowedIndices) == 0:
+			return fmt.Errorf("custom register type %s (%d) has no allowed indices", registerType.Name, mrType)
+		}
+	}
+	return nil
+}
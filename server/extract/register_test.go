@@ -0,0 +1,137 @@
+package extract
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+// hypotheticalMRType is a register type not known to go-eventlog.
+const hypotheticalMRType cel.MRType = 200
+
+// customRegisterCEL is a CEL whose records are measured into a register type
+// go-eventlog cannot append to.
+type customRegisterCEL struct {
+	cel.CEL
+	records []cel.Record
+}
+
+func (c customRegisterCEL) Records() []cel.Record { return c.records }
+
+func (c customRegisterCEL) MRType() cel.MRType { return hypotheticalMRType }
+
+// buildCustomRegisterCEL returns a log of events measured into index of the
+// hypothetical register type.
+func buildCustomRegisterCEL(t *testing.T, index uint8, events []coscel.COSTLV) cel.CEL {
+	t.Helper()
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	records := eventLog.Records()
+	for i := range records {
+		records[i].IndexType = hypotheticalMRType
+		records[i].Index = index
+	}
+	return customRegisterCEL{CEL: eventLog, records: records}
+}
+
+func TestCustomRegisterType(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCustomRegisterCEL(t, 7, events)
+	var validated int
+	opts := Options{CustomRegisterTypes: map[cel.MRType]RegisterType{
+		hypotheticalMRType: {
+			Name:           "FMR",
+			AllowedIndices: []uint8{7},
+			ValidateRecord: func(cel.Record) error {
+				validated++
+				return nil
+			},
+		},
+	}}
+
+	registerType, err := DetectRegisterType(eventLog, opts)
+	if err != nil {
+		t.Fatalf("DetectRegisterType() returned error: %v", err)
+	}
+	if registerType != uint8(hypotheticalMRType) {
+		t.Errorf("DetectRegisterType() = %d, want %d", registerType, hypotheticalMRType)
+	}
+	state, err := ExtractCOSState(eventLog, registerType, opts)
+	if err != nil {
+		t.Fatalf("ExtractCOSState() returned error: %v", err)
+	}
+	if got := state.GetContainer().GetImageReference(); got != "docker.io/bazel/experimental/test:latest" {
+		t.Errorf("ExtractCOSState() image reference = %q, want the measured one", got)
+	}
+	if validated != len(events) {
+		t.Errorf("ValidateRecord called %d times, want %d", validated, len(events))
+	}
+
+	if _, err := ExtractCOSState(eventLog, registerType, Options{}); err == nil || !strings.Contains(err.Error(), "unknown COS CEL log index type") {
+		t.Errorf("ExtractCOSState() without the custom register type returned error %v, want unknown index type", err)
+	}
+}
+
+func TestCustomRegisterTypeErrors(t *testing.T) {
+	events := []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("img")}}
+	errInvalid := errors.New("bad platform measurement")
+	testCases := []struct {
+		name          string
+		index         uint8
+		registerTypes map[cel.MRType]RegisterType
+		wantErr       string
+	}{
+		{
+			name:          "unexpected index",
+			index:         8,
+			registerTypes: map[cel.MRType]RegisterType{hypotheticalMRType: {Name: "FMR", AllowedIndices: []uint8{7}}},
+			wantErr:       "found unexpected FMR 8",
+		},
+		{
+			name:  "record validation failure",
+			index: 7,
+			registerTypes: map[cel.MRType]RegisterType{hypotheticalMRType: {
+				Name:           "FMR",
+				AllowedIndices: []uint8{7},
+				ValidateRecord: func(cel.Record) error { return errInvalid },
+			}},
+			wantErr: "failed FMR validation: bad platform measurement",
+		},
+		{
+			name:          "no name",
+			index:         7,
+			registerTypes: map[cel.MRType]RegisterType{hypotheticalMRType: {AllowedIndices: []uint8{7}}},
+			wantErr:       "has no name",
+		},
+		{
+			name:          "no allowed indices",
+			index:         7,
+			registerTypes: map[cel.MRType]RegisterType{hypotheticalMRType: {Name: "FMR"}},
+			wantErr:       "has no allowed indices",
+		},
+		{
+			name:  "redefined built-in type",
+			index: 7,
+			registerTypes: map[cel.MRType]RegisterType{
+				hypotheticalMRType: {Name: "FMR", AllowedIndices: []uint8{7}},
+				cel.PCRType:        {Name: "PCR", AllowedIndices: []uint8{7}},
+			},
+			wantErr: "redefines a built-in register type",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCustomRegisterCEL(t, tc.index, events)
+			_, err := ExtractCOSState(eventLog, uint8(hypotheticalMRType), Options{CustomRegisterTypes: tc.registerTypes})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("ExtractCOSState() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
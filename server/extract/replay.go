@@ -0,0 +1,84 @@
+package extract
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-eventlog/cel"
+)
+
+// replayHashes are the digest algorithms ReplayAndVerify can replay with.
+var replayHashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// ReplayAndVerify extends the digests of the COS records in order, starting
+// from a zeroed register, and checks the result equals the expected (quoted)
+// register value. The digest algorithm is selected by the size of expected.
+// Every record must be of registerType and measured into the COS register of
+// that type.
+func ReplayAndVerify(eventLog cel.CEL, registerType uint8, expected []byte) error {
+	var hash crypto.Hash
+	for _, h := range replayHashes {
+		if h.Size() == len(expected) {
+			hash = h
+			break
+		}
+	}
+	if hash == 0 {
+		return fmt.Errorf("no supported digest algorithm with size %d for the expected register value", len(expected))
+	}
+
+	allowedIndices := Options{}.allowedIndices(cel.MRType(registerType))
+	if allowedIndices == nil {
+		return fmt.Errorf("unknown COS CEL log index type %d", registerType)
+	}
+	replayed := make([]byte, hash.Size())
+	for _, record := range eventLog.Records() {
+		if uint8(record.IndexType) != registerType {
+			return fmt.Errorf("expect registerType: %d, but get %d in a CEL record", registerType, record.IndexType)
+		}
+		if !slices.Contains(allowedIndices, record.Index) {
+			return fmt.Errorf("found unexpected register index %d in COS CEL log", record.Index)
+		}
+		digest, ok := record.Digests[hash]
+		if !ok {
+			return fmt.Errorf("CEL record %d did not contain a %v digest", record.RecNum, hash)
+		}
+		hasher := hash.New()
+		hasher.Write(replayed)
+		hasher.Write(digest)
+		replayed = hasher.Sum(nil)
+	}
+
+	if !bytes.Equal(replayed, expected) {
+		return fmt.Errorf("COS CEL replay with %v got register value %x, want %x", hash, replayed, expected)
+	}
+	return nil
+}
+
+// MeasuredBytes returns the bytes each COS record's digests are computed
+// over, in log order: the binary TLV encoding of the record content. It lets
+// independent tooling hash and replay the log itself. The digests of the
+// records are not verified.
+func MeasuredBytes(eventLog cel.CEL, registerType uint8) ([][]byte, error) {
+	allowedIndices := Options{}.allowedIndices(cel.MRType(registerType))
+	if allowedIndices == nil {
+		return nil, fmt.Errorf("unknown COS CEL log index type %d", registerType)
+	}
+	var measured [][]byte
+	for _, record := range eventLog.Records() {
+		if uint8(record.IndexType) != registerType {
+			return nil, fmt.Errorf("expect registerType: %d, but get %d in a CEL record", registerType, record.IndexType)
+		}
+		if !slices.Contains(allowedIndices, record.Index) {
+			return nil, fmt.Errorf("found unexpected register index %d in COS CEL log", record.Index)
+		}
+		b, err := record.Content.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("CEL record %d: failed to encode content: %v", record.RecNum, err)
+		}
+		measured = append(measured, b)
+	}
+	return measured, nil
+}
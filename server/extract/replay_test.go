@@ -0,0 +1,97 @@
+package extract
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-configfs-tsm/configfs/fakertmr"
+	configfstsmrtmr "github.com/google/go-configfs-tsm/rtmr"
+	"github.com/google/go-eventlog/cel"
+	"github.com/google/go-tdx-guest/rtmr"
+)
+
+func TestReplayAndVerify(t *testing.T) {
+	fakeRTMR := fakertmr.CreateRtmrSubsystem(t.TempDir())
+	eventLog := cel.NewConfComputeMR()
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	for _, event := range events {
+		if err := eventLog.AppendEvent(event, []crypto.Hash{crypto.SHA384}, coscel.COSCCELMRIndex, func(_ crypto.Hash, mrIndex int, digest []byte) error {
+			return rtmr.ExtendDigestClient(fakeRTMR, mrIndex-1, digest)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quoted, err := configfstsmrtmr.GetDigest(fakeRTMR, coscel.EventRTMRIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplayAndVerify(eventLog, uint8(cel.CCMRType), quoted.Digest); err != nil {
+		t.Errorf("ReplayAndVerify() with the quoted register value returned error: %v", err)
+	}
+
+	mismatched := bytes.Clone(quoted.Digest)
+	mismatched[0] ^= 0xff
+	if err := ReplayAndVerify(eventLog, uint8(cel.CCMRType), mismatched); err == nil {
+		t.Errorf("ReplayAndVerify() with a mismatching register value returned nil error, want error")
+	}
+
+	if err := ReplayAndVerify(eventLog, uint8(cel.CCMRType), make([]byte, crypto.SHA256.Size())); err == nil {
+		t.Errorf("ReplayAndVerify() with a register value of a bank missing from the log returned nil error, want error")
+	}
+
+	if err := ReplayAndVerify(eventLog, uint8(cel.CCMRType), []byte{1, 2, 3}); err == nil {
+		t.Errorf("ReplayAndVerify() with an invalid register value size returned nil error, want error")
+	}
+
+	if err := ReplayAndVerify(eventLog, uint8(cel.PCRType), quoted.Digest); err == nil {
+		t.Errorf("ReplayAndVerify() with the wrong register type returned nil error, want error")
+	}
+}
+
+func TestReplayAndVerifyEmptyLog(t *testing.T) {
+	if err := ReplayAndVerify(cel.NewConfComputeMR(), uint8(cel.CCMRType), make([]byte, crypto.SHA384.Size())); err != nil {
+		t.Errorf("ReplayAndVerify() of an empty log against a zeroed register returned error: %v", err)
+	}
+}
+
+func TestMeasuredBytes(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("img")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+	measured, err := MeasuredBytes(eventLog, uint8(cel.CCMRType))
+	if err != nil {
+		t.Fatalf("MeasuredBytes() returned error: %v", err)
+	}
+	// Each record is a COS TLV wrapping the event TLV: a type byte and a
+	// 4-byte big-endian length, then the value.
+	want := [][]byte{
+		{coscel.CELRType, 0, 0, 0, 8, byte(coscel.ImageRefType), 0, 0, 0, 3, 'i', 'm', 'g'},
+		{coscel.CELRType, 0, 0, 0, 5, byte(coscel.LaunchSeparatorType), 0, 0, 0, 0},
+	}
+	if len(measured) != len(want) {
+		t.Fatalf("MeasuredBytes() returned %d records, want %d", len(measured), len(want))
+	}
+	for i, record := range eventLog.Records() {
+		if !bytes.Equal(measured[i], want[i]) {
+			t.Errorf("MeasuredBytes() record %d = %x, want %x", i, measured[i], want[i])
+		}
+		hasher := crypto.SHA384.New()
+		hasher.Write(measured[i])
+		if digest := hasher.Sum(nil); !bytes.Equal(digest, record.Digests[crypto.SHA384]) {
+			t.Errorf("SHA-384 of MeasuredBytes() record %d = %x, want the record digest %x", i, digest, record.Digests[crypto.SHA384])
+		}
+	}
+
+	if _, err := MeasuredBytes(eventLog, uint8(cel.PCRType)); err == nil {
+		t.Error("MeasuredBytes() with the wrong register type returned nil error, want error")
+	}
+}
@@ -0,0 +1,35 @@
+package extract
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+// MatchEventSequence verifies the COS records of the log and checks their
+// event types are exactly template, in order, e.g. to require a launch to be
+// reproduced event for event. The error reports the first divergence.
+func MatchEventSequence(eventLog cel.CEL, registerType uint8, template []coscel.ContentType) error {
+	records := eventLog.Records()
+	opts := Options{}
+	if err := opts.checkRecordCount(records); err != nil {
+		return err
+	}
+	for i, record := range records {
+		cosTlv, err := verifyCOSRecord(record, registerType, opts)
+		if err != nil {
+			return err
+		}
+		if i >= len(template) {
+			return fmt.Errorf("CEL record %d: found unexpected %s event after the %d events of the template", record.RecNum, coscel.EventTypeName(cosTlv.EventType), len(template))
+		}
+		if cosTlv.EventType != template[i] {
+			return fmt.Errorf("CEL record %d: found %s event at position %d, want %s", record.RecNum, coscel.EventTypeName(cosTlv.EventType), i, coscel.EventTypeName(template[i]))
+		}
+	}
+	if len(records) < len(template) {
+		return fmt.Errorf("log ended after %d events, want %s event at position %d", len(records), coscel.EventTypeName(template[len(records)]), len(records))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+func TestMatchEventSequence(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	testCases := []struct {
+		name     string
+		template []coscel.ContentType
+		wantErr  string
+	}{
+		{
+			name:     "match",
+			template: []coscel.ContentType{coscel.ImageRefType, coscel.ArgType, coscel.LaunchSeparatorType},
+		},
+		{
+			name:     "different event",
+			template: []coscel.ContentType{coscel.ImageRefType, coscel.EnvVarType, coscel.LaunchSeparatorType},
+			wantErr:  "found Arg event at position 1, want EnvVar",
+		},
+		{
+			name:     "extra event",
+			template: []coscel.ContentType{coscel.ImageRefType, coscel.ArgType},
+			wantErr:  "found unexpected LaunchSeparator event after the 2 events of the template",
+		},
+		{
+			name:     "missing event",
+			template: []coscel.ContentType{coscel.ImageRefType, coscel.ArgType, coscel.LaunchSeparatorType, coscel.MemoryMonitorType},
+			wantErr:  "log ended after 3 events, want MemoryMonitor event at position 3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			err := MatchEventSequence(eventLog, uint8(cel.CCMRType), tc.template)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("MatchEventSequence() returned error %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("MatchEventSequence() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
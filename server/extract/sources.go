@@ -0,0 +1,151 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+// FieldSources maps each populated field of a COSState to the RecNum of the
+// CEL record it was extracted from. Fields are named by their Go path from
+// COSState, e.g. "Container.ImageReference", "Container.Args[1]" or
+// "Container.EnvVars[FOO]". Fields set by custom event handlers are named by
+// the event type name. For fields set by several records, such as a repeated
+// RestartPolicy event, the last record is reported.
+type FieldSources map[string]uint64
+
+// ExtractCOSStateWithSources is like ExtractCOSState, but also returns the
+// record each extracted field came from, to trace malformed or unexpected
+// values back to the log.
+func ExtractCOSStateWithSources(eventLog cel.CEL, registerType uint8, opts Options) (*COSState, FieldSources, error) {
+	sources := make(FieldSources)
+	state, err := extractCOSState(eventLog.Records(), registerType, opts, sources)
+	if state == nil {
+		return nil, nil, err
+	}
+	return state, sources, err
+}
+
+// sourceField returns the name of the field set by applying cosTlv to state,
+// or empty if the event did not populate a field.
+func sourceField(state *COSState, cosTlv coscel.COSTLV) string {
+	container := state.GetContainer()
+	containerExt := state.ContainerExtensions
+	switch cosTlv.EventType {
+	case coscel.ImageRefType:
+		return "Container.ImageReference"
+	case coscel.ImageDigestType:
+		return "Container.ImageDigest"
+	case coscel.RestartPolicyType:
+		return "Container.RestartPolicy"
+	case coscel.ImageIDType:
+		return "Container.ImageId"
+	case coscel.ArgType:
+		return fmt.Sprintf("Container.Args[%d]", len(container.GetArgs())-1)
+	case coscel.EnvVarType:
+		name, _, _ := strings.Cut(string(cosTlv.EventContent), "=")
+		return fmt.Sprintf("Container.EnvVars[%s]", name)
+	case coscel.OverrideArgType:
+		return fmt.Sprintf("Container.OverriddenArgs[%d]", len(container.GetOverriddenArgs())-1)
+	case coscel.OverrideEnvType:
+		name, _, _ := strings.Cut(string(cosTlv.EventContent), "=")
+		return fmt.Sprintf("Container.OverriddenEnvVars[%s]", name)
+	case coscel.LaunchSeparatorType:
+		if state.LaunchSeparatorPayload == "" {
+			return ""
+		}
+		return "LaunchSeparatorPayload"
+	case coscel.MemoryMonitorType:
+		return "HealthMonitoring.MemoryEnabled"
+	case coscel.GpuCCModeType:
+		return "GpuDeviceState.CcMode"
+	case coscel.GPUDeviceAttestationBindingType:
+		if state.GetGpuDeviceState().GetNvidiaAttestationReport() == nil {
+			return ""
+		}
+		return "GpuDeviceState.NvidiaAttestationReport"
+	case coscel.LauncherVersionType:
+		return "LauncherVersion"
+	case coscel.LaunchFailedType:
+		return "LaunchError"
+	case coscel.PrivilegedType:
+		return "ContainerExtensions.Privileged"
+	case coscel.CapabilityType:
+		return fmt.Sprintf("ContainerExtensions.Capabilities[%d]", len(containerExt.Capabilities)-1)
+	case coscel.TeeTechnologyType:
+		return "TeeTechnology"
+	case coscel.DNSServerType:
+		return fmt.Sprintf("ContainerExtensions.DNS.Servers[%d]", len(containerExt.DNS.Servers)-1)
+	case coscel.DNSSearchDomainType:
+		return fmt.Sprintf("ContainerExtensions.DNS.SearchDomains[%d]", len(containerExt.DNS.SearchDomains)-1)
+	case coscel.MountType:
+		return fmt.Sprintf("ContainerExtensions.Mounts[%d]", len(containerExt.Mounts)-1)
+	case coscel.PlatformType:
+		return "ContainerExtensions.Platform"
+	case coscel.RunAsUserType:
+		return "ContainerExtensions.RunAsUser"
+	case coscel.ImageCreatedType:
+		return "ContainerExtensions.ImageCreated"
+	case coscel.ProbeConfigType:
+		return fmt.Sprintf("ContainerExtensions.Probes[%d]", len(containerExt.Probes)-1)
+	case coscel.TerminationGracePeriodType:
+		return "ContainerExtensions.TerminationGracePeriod"
+	case coscel.RestartCountType:
+		return "ContainerExtensions.RestartCount"
+	case coscel.KernelCmdlineType:
+		return "BootState.KernelCmdline"
+	case coscel.LoggingConfigType:
+		return "ContainerExtensions.LoggingConfig"
+	case coscel.VulnerabilityScanType:
+		return "ContainerExtensions.VulnerabilityScan"
+	case coscel.PlatformMismatchType:
+		return "ContainerExtensions.HostPlatform"
+	case coscel.InstanceMetadataType:
+		return "InstanceMetadata"
+	case coscel.PullCredentialSourceType:
+		return "ContainerExtensions.PullCredentialSource"
+	case coscel.ReadOnlyRootfsType:
+		return "ContainerExtensions.ReadOnlyRootfs"
+	case coscel.ExperimentalFeatureType:
+		return fmt.Sprintf("ExperimentalFeatures[%d]", len(state.ExperimentalFeatures)-1)
+	case coscel.SeccompProfileType:
+		return "ContainerExtensions.SeccompProfile"
+	case coscel.SbomReferenceType:
+		return "ContainerExtensions.SbomReference"
+	case coscel.NetworkModeType:
+		return "ContainerExtensions.NetworkMode"
+	case coscel.AcceleratorType:
+		return fmt.Sprintf("ContainerExtensions.Accelerators[%d]", len(containerExt.Accelerators)-1)
+	case coscel.TokenAudienceType:
+		return fmt.Sprintf("TokenAudiences[%s]", cosTlv.EventContent)
+	case coscel.ProvenanceReferenceType:
+		return "ContainerExtensions.ProvenanceReference"
+	case coscel.LifecycleHookType:
+		return fmt.Sprintf("ContainerExtensions.LifecycleHooks[%d]", len(containerExt.LifecycleHooks)-1)
+	case coscel.LayerDigestType:
+		return fmt.Sprintf("ContainerExtensions.LayerDigests[%d]", len(containerExt.LayerDigests)-1)
+	case coscel.UlimitType:
+		return fmt.Sprintf("ContainerExtensions.Ulimits[%d]", len(containerExt.Ulimits)-1)
+	case coscel.SourceRevisionType:
+		return "ContainerExtensions.SourceRevision"
+	case coscel.NamespaceSharingType:
+		namespace, _, _ := strings.Cut(string(cosTlv.EventContent), "=")
+		return "ContainerExtensions.NamespaceSharing." + strings.ToUpper(namespace)
+	case coscel.SignerType:
+		return fmt.Sprintf("ContainerExtensions.Signers[%d]", len(containerExt.Signers)-1)
+	case coscel.SealingPolicyType:
+		return "SealingPolicy"
+	case coscel.LaunchPolicyType:
+		return "LaunchPolicy"
+	case coscel.NonceType:
+		return "Nonce"
+	case coscel.GrantedResourceType:
+		return fmt.Sprintf("GrantedResources[%d]", len(state.GrantedResources)-1)
+	case coscel.ConfigHashType:
+		return "ConfigHash"
+	default:
+		return coscel.EventTypeName(cosTlv.EventType)
+	}
+}
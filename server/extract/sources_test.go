@@ -0,0 +1,96 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+)
+
+func TestExtractCOSStateWithSources(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/bazel/experimental/test:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("/bin/sh")},
+		{EventType: coscel.ImageDigestType, EventContent: []byte("sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483")},
+		{EventType: coscel.ArgType, EventContent: []byte("-c")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("FOO=bar")},
+		{EventType: coscel.OverrideEnvType, EventContent: []byte("FOO=baz")},
+		{EventType: coscel.RestartPolicyType, EventContent: []byte("Always")},
+		{EventType: coscel.RestartPolicyType, EventContent: []byte("Never")},
+		{EventType: coscel.MountType, EventContent: []byte("type=tmpfs,target=/tmp")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	state, sources, err := ExtractCOSStateWithSources(eventLog, uint8(cel.CCMRType), Options{})
+	if err != nil {
+		t.Fatalf("ExtractCOSStateWithSources() returned error: %v", err)
+	}
+	want := FieldSources{
+		"Container.ImageReference":         0,
+		"Container.Args[0]":                1,
+		"Container.ImageDigest":            2,
+		"Container.Args[1]":                3,
+		"Container.EnvVars[FOO]":           4,
+		"Container.OverriddenEnvVars[FOO]": 5,
+		"Container.RestartPolicy":          7,
+		"ContainerExtensions.Mounts[0]":    8,
+	}
+	if diff := cmp.Diff(want, sources); diff != "" {
+		t.Errorf("ExtractCOSStateWithSources() returned unexpected sources diff (-want +got):\n%s", diff)
+	}
+	if got := state.GetContainer().GetImageReference(); got != string(events[0].EventContent) {
+		t.Errorf("ExtractCOSStateWithSources() got image reference %q, want %q", got, events[0].EventContent)
+	}
+}
+
+func TestExtractCOSStateWithSourcesLaunchSeparatorPayload(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload string
+		want    FieldSources
+	}{
+		{name: "empty payload", want: FieldSources{}},
+		{name: "payload", payload: "phase-1", want: FieldSources{"LaunchSeparatorPayload": 0}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+				{EventType: coscel.LaunchSeparatorType, EventContent: []byte(tc.payload)},
+			})
+			_, sources, err := ExtractCOSStateWithSources(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSStateWithSources() returned error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, sources); diff != "" {
+				t.Errorf("ExtractCOSStateWithSources() returned unexpected sources diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCOSStateWithSourcesTolerant(t *testing.T) {
+	events := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a:latest")},
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/b:latest")},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+	}
+	eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+
+	if _, _, err := ExtractCOSStateWithSources(eventLog, uint8(cel.CCMRType), Options{}); err == nil {
+		t.Fatal("ExtractCOSStateWithSources() returned nil error for a duplicate ImageRef, want error")
+	}
+	_, sources, err := ExtractCOSStateWithSources(eventLog, uint8(cel.CCMRType), Options{Tolerant: true})
+	if err == nil {
+		t.Fatal("ExtractCOSStateWithSources(Tolerant) returned nil error, want *MultiError")
+	}
+	// The rejected duplicate must not be reported as the source.
+	want := FieldSources{
+		"Container.ImageReference": 0,
+		"Container.Args[0]":        2,
+	}
+	if diff := cmp.Diff(want, sources); diff != "" {
+		t.Errorf("ExtractCOSStateWithSources(Tolerant) returned unexpected sources diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,59 @@
+package extract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/go-eventlog/cel"
+)
+
+// ndjsonRecord is a line written by ExtractStreamToNDJSON.
+type ndjsonRecord struct {
+	// Index is the position of the log in the input stream, from 0.
+	Index int `json:"index"`
+	// Status is "ok" if the state was extracted, "error" otherwise.
+	Status string `json:"status"`
+	// State is the MarshalCOSStateJSONStable encoding of the state.
+	State json.RawMessage `json:"state,omitempty"`
+	// Error is the extraction error.
+	Error string `json:"error,omitempty"`
+}
+
+// ExtractStreamToNDJSON extracts the COS state of every log received from in,
+// until in is closed, and writes one JSON line per log to out, in input
+// order:
+//
+//	{"index": int, "status": "ok", "state": <MarshalCOSStateJSONStable output>}
+//	{"index": int, "status": "error", "error": string}
+//
+// A log failing extraction does not stop the stream. An error is only
+// returned if writing to out fails or ctx is done before in is closed.
+func ExtractStreamToNDJSON(ctx context.Context, in <-chan cel.CEL, registerType uint8, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	for index := 0; ; index++ {
+		var eventLog cel.CEL
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case l, ok := <-in:
+			if !ok {
+				return nil
+			}
+			eventLog = l
+		}
+
+		record := ndjsonRecord{Index: index, Status: "ok"}
+		state, err := VerifiedCOSState(eventLog, registerType, Options{})
+		if err == nil {
+			record.State, err = MarshalCOSStateJSONStable(state)
+		}
+		if err != nil {
+			record = ndjsonRecord{Index: index, Status: "error", Error: err.Error()}
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write the state of log %d: %v", index, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package extract
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-eventlog/cel"
+)
+
+func TestExtractStreamToNDJSON(t *testing.T) {
+	logs := []cel.CEL{
+		buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+			{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/first:latest")},
+		}),
+		buildCEL(t, cel.PCRType, coscel.EventPCRIndex, []coscel.COSTLV{
+			{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/pcr:latest")},
+		}),
+		buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, []coscel.COSTLV{
+			{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/library/third:latest")},
+		}),
+	}
+	in := make(chan cel.CEL, len(logs))
+	for _, eventLog := range logs {
+		in <- eventLog
+	}
+	close(in)
+
+	var out strings.Builder
+	if err := ExtractStreamToNDJSON(context.Background(), in, uint8(cel.CCMRType), &out); err != nil {
+		t.Fatalf("ExtractStreamToNDJSON() returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(logs) {
+		t.Fatalf("ExtractStreamToNDJSON() wrote %d lines, want %d:\n%s", len(lines), len(logs), out.String())
+	}
+	wantImages := []string{"docker.io/library/first:latest", "", "docker.io/library/third:latest"}
+	for i, line := range lines {
+		var record struct {
+			Index  int    `json:"index"`
+			Status string `json:"status"`
+			State  *struct {
+				Container struct {
+					ImageReference string `json:"image_reference"`
+				} `json:"container"`
+			} `json:"state"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %d %q is not JSON: %v", i, line, err)
+		}
+		if record.Index != i {
+			t.Errorf("line %d has index %d, want %d", i, record.Index, i)
+		}
+		if wantImages[i] == "" {
+			if record.Status != "error" || record.Error == "" || record.State != nil {
+				t.Errorf("line %d = %s, want an error status", i, line)
+			}
+			continue
+		}
+		if record.Status != "ok" || record.State == nil || record.State.Container.ImageReference != wantImages[i] {
+			t.Errorf("line %d = %s, want an ok status with image reference %q", i, line, wantImages[i])
+		}
+	}
+}
+
+func TestExtractStreamToNDJSONCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out strings.Builder
+	if err := ExtractStreamToNDJSON(ctx, make(chan cel.CEL), uint8(cel.CCMRType), &out); !errors.Is(err, context.Canceled) {
+		t.Errorf("ExtractStreamToNDJSON() with a canceled context returned error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,242 @@
+package extract
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+// ValidateLaunchSettings checks that the restart policy and health monitoring
+// settings of an extracted COS state describe a launch COS can perform. The
+// COS event log records each launch setting independently, so a log can be
+// well-formed while describing a launch COS would never perform:
+//   - The restart policy must be a RestartPolicy known to this package.
+//   - The restart policy and health monitoring only apply to a launched
+//     container, so a non-default (not Always) restart policy or enabled
+//     memory monitoring requires the container image reference.
+//
+// This is not a check of restart policies against monitoring settings: COS
+// accepts every restart policy with memory monitoring enabled or disabled,
+// so no combination of the two is rejected. All inconsistencies found are
+// returned together.
+func ValidateLaunchSettings(state *pb.AttestedCosState) error {
+	container := state.GetContainer()
+	var errs []error
+
+	restartPolicy := container.GetRestartPolicy()
+	if _, ok := pb.RestartPolicy_name[int32(restartPolicy)]; !ok {
+		errs = append(errs, fmt.Errorf("unknown restart policy %d", restartPolicy))
+	}
+
+	if container.GetImageReference() == "" {
+		if restartPolicy != pb.RestartPolicy_Always {
+			errs = append(errs, fmt.Errorf("restart policy %v set without a container image reference", restartPolicy))
+		}
+		if state.GetHealthMonitoring().GetMemoryEnabled() {
+			errs = append(errs, errors.New("memory monitoring enabled without a container image reference"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateImageConsistency checks the presence of the container image fields
+// is consistent. ImageDigest (the registry manifest digest) and ImageID (the
+// local config digest) identify different objects, but a measured image
+// reference must come with at least one of them, and neither can be measured
+// without an image reference.
+func ValidateImageConsistency(state *pb.ContainerState) error {
+	hasIdentity := state.GetImageDigest() != "" || state.GetImageId() != ""
+	if state.GetImageReference() != "" && !hasIdentity {
+		return fmt.Errorf("image reference %q has neither an image digest nor an image ID", state.GetImageReference())
+	}
+	if state.GetImageReference() == "" && hasIdentity {
+		return errors.New("image digest or image ID set without an image reference")
+	}
+	return nil
+}
+
+// ValidateImageIdentity checks the container image is fully identified: the
+// image reference, image digest and image ID are all measured, the image
+// digest is well formed, and a reference pinned by digest names the measured
+// image digest. All violations are returned together. Unlike
+// ValidateImageConsistency, it rejects images identified by only one digest.
+func ValidateImageIdentity(state *pb.ContainerState) error {
+	var errs []error
+	if state.GetImageReference() == "" {
+		errs = append(errs, errors.New("image reference is empty"))
+	}
+	switch imageDigest := state.GetImageDigest(); {
+	case imageDigest == "":
+		errs = append(errs, errors.New("image digest is empty"))
+	case !digestRegexp.MatchString(imageDigest):
+		errs = append(errs, fmt.Errorf("image digest %q is not of the form <algorithm>:<encoded>", imageDigest))
+	default:
+		if digest, ok := referenceDigest(state.GetImageReference()); ok && digest != imageDigest {
+			errs = append(errs, fmt.Errorf("image reference %q is pinned to a digest other than the image digest %q", state.GetImageReference(), imageDigest))
+		}
+	}
+	if state.GetImageId() == "" {
+		errs = append(errs, errors.New("image ID is empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// containerExtensions returns the ContainerExtensions of the state, or empty
+// ones if the state has none, e.g. one built by the caller rather than
+// extracted.
+func (s *COSState) containerExtensions() *ContainerExtensions {
+	if s.ContainerExtensions == nil {
+		return &ContainerExtensions{}
+	}
+	return s.ContainerExtensions
+}
+
+// VerifyNonce checks the nonce recorded in the state matches the expected
+// challenge issued by the verifier, binding the log to a fresh attestation.
+// The comparison is constant time.
+func (s *COSState) VerifyNonce(expected []byte) error {
+	if len(expected) == 0 {
+		return errors.New("expected nonce is empty")
+	}
+	if s.Nonce == nil {
+		return errors.New("no nonce recorded in the COS event log")
+	}
+	if subtle.ConstantTimeCompare(s.Nonce, expected) != 1 {
+		return errors.New("recorded nonce does not match the expected nonce")
+	}
+	return nil
+}
+
+// RanAsRoot reports whether the container process may have run as root: the
+// recorded user is "root" or UID 0, or no user was recorded, in which case the
+// container runtime defaults to root. A named user is not resolved against
+// the image, so a non-root name mapped to UID 0 is not detected.
+func (s *COSState) RanAsRoot() bool {
+	containerExt := s.containerExtensions()
+	if containerExt.RunAsUser == "" {
+		return true
+	}
+	if containerExt.RunAsUID != nil {
+		return *containerExt.RunAsUID == 0
+	}
+	user, _, _ := strings.Cut(containerExt.RunAsUser, ":")
+	return user == "root"
+}
+
+// VerifyConfigHash checks the workload config hash recorded in the state
+// equals expected.
+func (s *COSState) VerifyConfigHash(expected string) error {
+	if s.ConfigHash == "" {
+		return errors.New("no config hash recorded in the COS event log")
+	}
+	if s.ConfigHash != expected {
+		return fmt.Errorf("config hash %q does not match the expected %q", s.ConfigHash, expected)
+	}
+	return nil
+}
+
+// CheckImageAge checks the container image was created at most maxAge before
+// now. An image without a recorded creation time, or created after now, fails
+// the check.
+func (s *COSState) CheckImageAge(maxAge time.Duration, now time.Time) error {
+	created := s.containerExtensions().ImageCreated
+	if created.IsZero() {
+		return errors.New("no image creation time recorded in the COS event log")
+	}
+	if created.After(now) {
+		return fmt.Errorf("image creation time %v is in the future", created)
+	}
+	if age := now.Sub(created); age > maxAge {
+		return fmt.Errorf("image created at %v is %v old, want at most %v", created, age, maxAge)
+	}
+	return nil
+}
+
+// RequireSigners checks the container image was signed by every required
+// signer. Additional signers are allowed. All missing signers are reported.
+func (s *COSState) RequireSigners(required []string) error {
+	var missing []string
+	for _, signer := range required {
+		if !slices.Contains(s.containerExtensions().Signers, signer) {
+			missing = append(missing, signer)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("container image is missing signatures from required signers: %v", missing)
+	}
+	return nil
+}
+
+// RequireNoExperimentalFeatures checks the workload ran without experimental
+// launcher features, for policies which only accept stable launcher behavior.
+func (s *COSState) RequireNoExperimentalFeatures() error {
+	if len(s.ExperimentalFeatures) > 0 {
+		return fmt.Errorf("workload ran with experimental features enabled: %v", s.ExperimentalFeatures)
+	}
+	return nil
+}
+
+// RequireSBOM checks a Software Bill of Materials reference was recorded for
+// the container image. The referenced SBOM itself is not fetched or checked.
+func (s *COSState) RequireSBOM() error {
+	if s.containerExtensions().SbomReference == "" {
+		return errors.New("container image has no SBOM reference")
+	}
+	return nil
+}
+
+// RequireAudience checks the workload requested identity tokens for the
+// audience.
+func (s *COSState) RequireAudience(aud string) error {
+	if _, ok := s.TokenAudiences[aud]; !ok {
+		return fmt.Errorf("workload did not request tokens for audience %q", aud)
+	}
+	return nil
+}
+
+// RequireProvenance checks a provenance attestation reference was recorded
+// for the container image. The referenced attestation itself is not fetched
+// or checked.
+func (s *COSState) RequireProvenance() error {
+	if s.containerExtensions().ProvenanceReference == "" {
+		return errors.New("container image has no provenance reference")
+	}
+	return nil
+}
+
+// VerifySourceRevision checks the container image was built from the
+// expected git commit, given as a full hex object name.
+func (s *COSState) VerifySourceRevision(expected string) error {
+	revision := s.containerExtensions().SourceRevision
+	if revision == "" {
+		return errors.New("source revision is empty")
+	}
+	expected = strings.ToLower(expected)
+	if revision != expected {
+		return fmt.Errorf("source revision %s does not match the expected revision %s", revision, expected)
+	}
+	return nil
+}
+
+// RequireIsolatedNamespaces checks the container shared neither its PID nor
+// its IPC namespace with the host. Namespaces without a recorded mode are
+// assumed private.
+func (s *COSState) RequireIsolatedNamespaces() error {
+	namespaces := s.containerExtensions().NamespaceSharing
+	var shared []string
+	if namespaces.PID == NamespaceModeHost {
+		shared = append(shared, "pid")
+	}
+	if namespaces.IPC == NamespaceModeHost {
+		shared = append(shared, "ipc")
+	}
+	if len(shared) > 0 {
+		return fmt.Errorf("container shared host namespaces: %v", shared)
+	}
+	return nil
+}
@@ -0,0 +1,549 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+	pb "github.com/google/go-tpm-tools/proto/attest"
+)
+
+func TestValidateLaunchSettings(t *testing.T) {
+	enabled := true
+	disabled := false
+	testCases := []struct {
+		name    string
+		state   *pb.AttestedCosState
+		wantErr bool
+	}{
+		{
+			name:  "empty state",
+			state: &pb.AttestedCosState{},
+		},
+		{
+			name: "restart policy with container",
+			state: &pb.AttestedCosState{
+				Container: &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest", RestartPolicy: pb.RestartPolicy_Never},
+			},
+		},
+		{
+			name: "memory monitoring with container",
+			state: &pb.AttestedCosState{
+				Container:        &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest", RestartPolicy: pb.RestartPolicy_OnFailure},
+				HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &enabled},
+			},
+		},
+		{
+			name: "memory monitoring disabled without container",
+			state: &pb.AttestedCosState{
+				Container:        &pb.ContainerState{},
+				HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &disabled},
+			},
+		},
+		{
+			name: "restart policy without container",
+			state: &pb.AttestedCosState{
+				Container: &pb.ContainerState{RestartPolicy: pb.RestartPolicy_Never},
+			},
+			wantErr: true,
+		},
+		{
+			name: "memory monitoring without container",
+			state: &pb.AttestedCosState{
+				Container:        &pb.ContainerState{},
+				HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: &enabled},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown restart policy",
+			state: &pb.AttestedCosState{
+				Container: &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest", RestartPolicy: pb.RestartPolicy(100)},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateLaunchSettings(tc.state)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ValidateLaunchSettings() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLaunchSettingsPolicyAndMonitoring(t *testing.T) {
+	// Every restart policy is valid with memory monitoring in any state.
+	for _, restartPolicy := range []pb.RestartPolicy{pb.RestartPolicy_Always, pb.RestartPolicy_OnFailure, pb.RestartPolicy_Never} {
+		for _, memoryEnabled := range []*bool{nil, ptr(false), ptr(true)} {
+			state := &pb.AttestedCosState{
+				Container:        &pb.ContainerState{ImageReference: "docker.io/library/hello-world:latest", RestartPolicy: restartPolicy},
+				HealthMonitoring: &pb.HealthMonitoringState{MemoryEnabled: memoryEnabled},
+			}
+			if err := ValidateLaunchSettings(state); err != nil {
+				t.Errorf("ValidateLaunchSettings() with restart policy %v and memory monitoring %v returned error: %v", restartPolicy, state.GetHealthMonitoring().GetMemoryEnabled(), err)
+			}
+		}
+	}
+}
+
+func TestValidateImageConsistency(t *testing.T) {
+	const imageRef = "docker.io/library/hello-world:latest"
+	testCases := []struct {
+		name    string
+		state   *pb.ContainerState
+		wantErr bool
+	}{
+		{name: "nothing set", state: &pb.ContainerState{}},
+		{name: "reference and both digests", state: &pb.ContainerState{ImageReference: imageRef, ImageDigest: testImageDigest, ImageId: testImageID}},
+		{name: "reference and image digest", state: &pb.ContainerState{ImageReference: imageRef, ImageDigest: testImageDigest}},
+		{name: "reference and image ID", state: &pb.ContainerState{ImageReference: imageRef, ImageId: testImageID}},
+		{name: "reference only", state: &pb.ContainerState{ImageReference: imageRef}, wantErr: true},
+		{name: "image digest only", state: &pb.ContainerState{ImageDigest: testImageDigest}, wantErr: true},
+		{name: "image ID only", state: &pb.ContainerState{ImageId: testImageID}, wantErr: true},
+		{name: "both digests without reference", state: &pb.ContainerState{ImageDigest: testImageDigest, ImageId: testImageID}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateImageConsistency(tc.state)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("ValidateImageConsistency() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateImageIdentity(t *testing.T) {
+	const imageRef = "docker.io/library/hello-world"
+	testCases := []struct {
+		name     string
+		state    *pb.ContainerState
+		wantErrs []string
+	}{
+		{
+			name:  "tagged reference",
+			state: &pb.ContainerState{ImageReference: imageRef + ":latest", ImageDigest: testImageDigest, ImageId: testImageID},
+		},
+		{
+			name:  "pinned reference",
+			state: &pb.ContainerState{ImageReference: imageRef + "@" + testImageDigest, ImageDigest: testImageDigest, ImageId: testImageID},
+		},
+		{
+			name:     "nothing set",
+			state:    &pb.ContainerState{},
+			wantErrs: []string{"image reference is empty", "image digest is empty", "image ID is empty"},
+		},
+		{
+			name:     "malformed digest without image ID",
+			state:    &pb.ContainerState{ImageReference: imageRef, ImageDigest: "781d8dfdd921"},
+			wantErrs: []string{"image digest \"781d8dfdd921\" is not of the form", "image ID is empty"},
+		},
+		{
+			name:     "pinned to another digest",
+			state:    &pb.ContainerState{ImageReference: imageRef + "@" + testImageID, ImageDigest: testImageDigest, ImageId: testImageID},
+			wantErrs: []string{"is pinned to a digest other than the image digest"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateImageIdentity(tc.state)
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("ValidateImageIdentity() returned error %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateImageIdentity() returned no error, want errors: %v", tc.wantErrs)
+			}
+			for _, wantErr := range tc.wantErrs {
+				if !strings.Contains(err.Error(), wantErr) {
+					t.Errorf("ValidateImageIdentity() returned error %v, want error: %v", err, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyNonce(t *testing.T) {
+	nonce := []byte("verifier-challenge-0123456789")
+	testCases := []struct {
+		name     string
+		events   []coscel.COSTLV
+		expected []byte
+		wantErr  bool
+	}{
+		{
+			name:     "matching nonce",
+			events:   []coscel.COSTLV{{EventType: coscel.NonceType, EventContent: nonce}},
+			expected: nonce,
+		},
+		{
+			name:     "mismatching nonce",
+			events:   []coscel.COSTLV{{EventType: coscel.NonceType, EventContent: nonce}},
+			expected: []byte("another-challenge"),
+			wantErr:  true,
+		},
+		{
+			name:     "nonce prefix",
+			events:   []coscel.COSTLV{{EventType: coscel.NonceType, EventContent: nonce}},
+			expected: nonce[:4],
+			wantErr:  true,
+		},
+		{
+			name:     "no recorded nonce",
+			expected: nonce,
+			wantErr:  true,
+		},
+		{
+			name:    "empty expected nonce",
+			events:  []coscel.COSTLV{{EventType: coscel.NonceType, EventContent: nonce}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if err := state.VerifyNonce(tc.expected); (err != nil) != tc.wantErr {
+				t.Errorf("VerifyNonce() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRanAsRoot(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ext      *ContainerExtensions
+		wantRoot bool
+	}{
+		{name: "no container extensions", wantRoot: true},
+		{name: "not recorded", ext: &ContainerExtensions{}, wantRoot: true},
+		{name: "root user", ext: &ContainerExtensions{RunAsUser: "root"}, wantRoot: true},
+		{name: "root user with group", ext: &ContainerExtensions{RunAsUser: "root:1000"}, wantRoot: true},
+		{name: "root UID", ext: &ContainerExtensions{RunAsUser: "0", RunAsUID: ptr(uint32(0))}, wantRoot: true},
+		{name: "root UID with group", ext: &ContainerExtensions{RunAsUser: "0:1000", RunAsUID: ptr(uint32(0))}, wantRoot: true},
+		{name: "named user", ext: &ContainerExtensions{RunAsUser: "nobody"}},
+		{name: "UID", ext: &ContainerExtensions{RunAsUser: "65532", RunAsUID: ptr(uint32(65532))}},
+		{name: "UID with root group", ext: &ContainerExtensions{RunAsUser: "1000:0", RunAsUID: ptr(uint32(1000))}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{ContainerExtensions: tc.ext}
+			if got := state.RanAsRoot(); got != tc.wantRoot {
+				t.Errorf("RanAsRoot() = %v, want %v", got, tc.wantRoot)
+			}
+		})
+	}
+}
+
+func TestPolicyHelpersWithoutContainerExtensions(t *testing.T) {
+	// A state built by the caller may have no ContainerExtensions, which the
+	// helpers treat as nothing recorded.
+	state := &COSState{}
+	if !state.RanAsRoot() {
+		t.Error("RanAsRoot() = false, want true")
+	}
+	checks := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "CheckImageAge", err: state.CheckImageAge(time.Hour, time.Now()), wantErr: true},
+		{name: "RequireSigners", err: state.RequireSigners([]string{"signer"}), wantErr: true},
+		{name: "RequireSBOM", err: state.RequireSBOM(), wantErr: true},
+		{name: "RequireProvenance", err: state.RequireProvenance(), wantErr: true},
+		{name: "VerifySourceRevision", err: state.VerifySourceRevision("0123456789abcdef0123456789abcdef01234567"), wantErr: true},
+		{name: "RequireIsolatedNamespaces", err: state.RequireIsolatedNamespaces()},
+	}
+	for _, check := range checks {
+		if gotErr := check.err != nil; gotErr != check.wantErr {
+			t.Errorf("%s() returned error %v, want error: %v", check.name, check.err, check.wantErr)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestVerifyConfigHash(t *testing.T) {
+	configHash := "sha256:" + strings.Repeat("0f", 32)
+	testCases := []struct {
+		name       string
+		configHash string
+		expected   string
+		wantErr    bool
+	}{
+		{name: "matching", configHash: configHash, expected: configHash},
+		{name: "mismatching", configHash: configHash, expected: "sha256:" + strings.Repeat("f0", 32), wantErr: true},
+		{name: "not recorded", expected: configHash, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{ConfigHash: tc.configHash}
+			if err := state.VerifyConfigHash(tc.expected); (err != nil) != tc.wantErr {
+				t.Errorf("VerifyConfigHash() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckImageAge(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	const maxAge = 30 * 24 * time.Hour
+	testCases := []struct {
+		name    string
+		created time.Time
+		wantErr bool
+	}{
+		{name: "fresh image", created: time.Date(2024, 5, 20, 8, 30, 0, 0, time.UTC)},
+		{name: "fresh image with offset", created: time.Date(2024, 5, 31, 23, 0, 0, 0, time.FixedZone("", -7*60*60))},
+		{name: "at max age", created: now.Add(-maxAge)},
+		{name: "stale image", created: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), wantErr: true},
+		{name: "future image", created: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), wantErr: true},
+		{name: "not recorded", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{ContainerExtensions: &ContainerExtensions{ImageCreated: tc.created}}
+			if err := state.CheckImageAge(maxAge, now); (err != nil) != tc.wantErr {
+				t.Errorf("CheckImageAge() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireSigners(t *testing.T) {
+	signers := []string{"projects/p/attestors/build", "projects/p/attestors/security-review"}
+	testCases := []struct {
+		name     string
+		signers  []string
+		required []string
+		wantErr  bool
+	}{
+		{name: "no requirement", signers: signers},
+		{name: "all required present", signers: signers, required: signers},
+		{name: "subset required", signers: signers, required: signers[1:]},
+		{name: "required missing", signers: signers[:1], required: signers, wantErr: true},
+		{name: "not signed", required: signers[:1], wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, signer := range tc.signers {
+				events = append(events, coscel.COSTLV{EventType: coscel.SignerType, EventContent: []byte(signer)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if diff := cmp.Diff(tc.signers, state.ContainerExtensions.Signers); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected signers diff (-want +got):\n%s", diff)
+			}
+			if err := state.RequireSigners(tc.required); (err != nil) != tc.wantErr {
+				t.Errorf("RequireSigners() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireNoExperimentalFeatures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		features []string
+		wantErr  bool
+	}{
+		{name: "absent"},
+		{name: "present", features: []string{"enable_gpu_cc", "mount_shared_memory"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, feature := range tc.features {
+				events = append(events, coscel.COSTLV{EventType: coscel.ExperimentalFeatureType, EventContent: []byte(feature)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if diff := cmp.Diff(tc.features, state.ExperimentalFeatures); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected experimental features diff (-want +got):\n%s", diff)
+			}
+			if err := state.RequireNoExperimentalFeatures(); (err != nil) != tc.wantErr {
+				t.Errorf("RequireNoExperimentalFeatures() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireSBOM(t *testing.T) {
+	const sbom = "us-docker.pkg.dev/p/repo/image@sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483.sbom"
+	testCases := []struct {
+		name    string
+		sboms   []string
+		wantErr bool
+	}{
+		{name: "present", sboms: []string{sbom}},
+		{name: "absent", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, sbom := range tc.sboms {
+				events = append(events, coscel.COSTLV{EventType: coscel.SbomReferenceType, EventContent: []byte(sbom)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if len(tc.sboms) > 0 && state.ContainerExtensions.SbomReference != tc.sboms[0] {
+				t.Errorf("ExtractCOSState() got SBOM reference %q, want %q", state.ContainerExtensions.SbomReference, tc.sboms[0])
+			}
+			if err := state.RequireSBOM(); (err != nil) != tc.wantErr {
+				t.Errorf("RequireSBOM() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireAudience(t *testing.T) {
+	const audience = "https://sts.googleapis.com"
+	testCases := []struct {
+		name      string
+		audiences map[string]struct{}
+		wantErr   bool
+	}{
+		{name: "absent", wantErr: true},
+		{name: "present", audiences: map[string]struct{}{audience: {}}},
+		{name: "present among others", audiences: map[string]struct{}{audience: {}, "https://example.com": {}}},
+		{name: "other audience only", audiences: map[string]struct{}{"https://example.com": {}}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &COSState{TokenAudiences: tc.audiences}
+			if err := state.RequireAudience(audience); (err != nil) != tc.wantErr {
+				t.Errorf("RequireAudience() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireProvenance(t *testing.T) {
+	const provenance = "us-docker.pkg.dev/p/repo/image@sha256:781d8dfdd92118436bd914442c8339e653b83f6bf3c1a7a98efcfb7c4fed7483.att"
+	testCases := []struct {
+		name        string
+		provenances []string
+		wantErr     bool
+	}{
+		{name: "present", provenances: []string{provenance}},
+		{name: "absent", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, provenance := range tc.provenances {
+				events = append(events, coscel.COSTLV{EventType: coscel.ProvenanceReferenceType, EventContent: []byte(provenance)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if len(tc.provenances) > 0 && state.ContainerExtensions.ProvenanceReference != tc.provenances[0] {
+				t.Errorf("ExtractCOSState() got provenance reference %q, want %q", state.ContainerExtensions.ProvenanceReference, tc.provenances[0])
+			}
+			if err := state.RequireProvenance(); (err != nil) != tc.wantErr {
+				t.Errorf("RequireProvenance() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySourceRevision(t *testing.T) {
+	const revision = "3f2a9c1d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39"
+	testCases := []struct {
+		name     string
+		events   []coscel.COSTLV
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "matching revision",
+			events:   []coscel.COSTLV{{EventType: coscel.SourceRevisionType, EventContent: []byte(revision)}},
+			expected: revision,
+		},
+		{
+			name:     "matching uppercase expected revision",
+			events:   []coscel.COSTLV{{EventType: coscel.SourceRevisionType, EventContent: []byte(revision)}},
+			expected: strings.ToUpper(revision),
+		},
+		{
+			name:     "mismatching revision",
+			events:   []coscel.COSTLV{{EventType: coscel.SourceRevisionType, EventContent: []byte(revision)}},
+			expected: "0000000000000000000000000000000000000000",
+			wantErr:  true,
+		},
+		{
+			name:     "absent revision",
+			expected: revision,
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if err := state.VerifySourceRevision(tc.expected); (err != nil) != tc.wantErr {
+				t.Errorf("VerifySourceRevision() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireIsolatedNamespaces(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []string
+		want    NamespaceSharing
+		wantErr bool
+	}{
+		{name: "not recorded"},
+		{name: "isolated", values: []string{"pid=private", "ipc=private"}, want: NamespaceSharing{PID: NamespaceModePrivate, IPC: NamespaceModePrivate}},
+		{name: "host pid", values: []string{"pid=host", "ipc=private"}, want: NamespaceSharing{PID: NamespaceModeHost, IPC: NamespaceModePrivate}, wantErr: true},
+		{name: "host ipc", values: []string{"ipc=host"}, want: NamespaceSharing{IPC: NamespaceModeHost}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []coscel.COSTLV
+			for _, value := range tc.values {
+				events = append(events, coscel.COSTLV{EventType: coscel.NamespaceSharingType, EventContent: []byte(value)})
+			}
+			eventLog := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, events)
+			state, err := ExtractCOSState(eventLog, uint8(cel.CCMRType), Options{})
+			if err != nil {
+				t.Fatalf("ExtractCOSState() returned error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, state.ContainerExtensions.NamespaceSharing); diff != "" {
+				t.Errorf("ExtractCOSState() returned unexpected namespace sharing diff (-want +got):\n%s", diff)
+			}
+			if err := state.RequireIsolatedNamespaces(); (err != nil) != tc.wantErr {
+				t.Errorf("RequireIsolatedNamespaces() returned error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
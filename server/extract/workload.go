@@ -0,0 +1,90 @@
+package extract
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/google/go-eventlog/cel"
+	"google.golang.org/protobuf/proto"
+)
+
+// ephemeralFields lists the COSState fields, by their Go path from COSState,
+// which differ between launches of the same workload, or only record how the
+// log was extracted, and are ignored by SameWorkload.
+var ephemeralFields = []string{"AttestedCosState", "RawContents", "Nonce", "Events", "Warnings", "InstanceMetadata", "DigestAlgs", "ContainerExtensions.RestartCount"}
+
+// SameWorkload extracts the COS states of both logs and reports whether they
+// describe the same workload, e.g. a new launch and a known-good prior one.
+// Ephemeral fields, such as the attestation nonce, are ignored. If the
+// workloads differ, the names of the differing fields are returned, named by
+// their Go path from COSState as in FieldSources.
+func SameWorkload(logA, logB cel.CEL, registerType uint8) (bool, []string, error) {
+	a, err := ExtractCOSState(logA, registerType, Options{})
+	if err != nil {
+		return false, nil, err
+	}
+	b, err := ExtractCOSState(logB, registerType, Options{})
+	if err != nil {
+		return false, nil, err
+	}
+	diffs := workloadDiff(a, b)
+	return len(diffs) == 0, diffs, nil
+}
+
+// workloadDiff returns the names of the non-ephemeral fields which differ
+// between a and b.
+func workloadDiff(a, b *COSState) []string {
+	var diffs []string
+	diff := func(name string, equal bool) {
+		if !equal {
+			diffs = append(diffs, name)
+		}
+	}
+
+	stateA, stateB := canonicalCOSState(a.AttestedCosState), canonicalCOSState(b.AttestedCosState)
+	containerA, containerB := stateA.GetContainer(), stateB.GetContainer()
+	diff("Container.ImageReference", containerA.GetImageReference() == containerB.GetImageReference())
+	diff("Container.ImageDigest", containerA.GetImageDigest() == containerB.GetImageDigest())
+	diff("Container.RestartPolicy", containerA.GetRestartPolicy() == containerB.GetRestartPolicy())
+	diff("Container.ImageId", containerA.GetImageId() == containerB.GetImageId())
+	diff("Container.Args", slices.Equal(containerA.GetArgs(), containerB.GetArgs()))
+	diff("Container.EnvVars", maps.Equal(containerA.GetEnvVars(), containerB.GetEnvVars()))
+	diff("Container.OverriddenArgs", slices.Equal(containerA.GetOverriddenArgs(), containerB.GetOverriddenArgs()))
+	diff("Container.OverriddenEnvVars", maps.Equal(containerA.GetOverriddenEnvVars(), containerB.GetOverriddenEnvVars()))
+	diff("CosVersion", proto.Equal(stateA.GetCosVersion(), stateB.GetCosVersion()))
+	diff("LauncherVersion", proto.Equal(stateA.GetLauncherVersion(), stateB.GetLauncherVersion()))
+	diff("HealthMonitoring", proto.Equal(stateA.GetHealthMonitoring(), stateB.GetHealthMonitoring()))
+	diff("GpuDeviceState", proto.Equal(stateA.GetGpuDeviceState(), stateB.GetGpuDeviceState()))
+
+	diffs = append(diffs, structDiff("", reflect.ValueOf(*a), reflect.ValueOf(*b))...)
+	return diffs
+}
+
+// structDiff returns the names, prefixed by prefix, of the fields of the
+// structs a and b which are not deeply equal, skipping ephemeralFields.
+// ContainerExtensions is compared per field.
+func structDiff(prefix string, a, b reflect.Value) []string {
+	var diffs []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if slices.Contains(ephemeralFields, prefix+field.Name) {
+			continue
+		}
+		fieldA, fieldB := a.Field(i), b.Field(i)
+		if field.Type == reflect.TypeOf(&ContainerExtensions{}) {
+			if fieldA.IsNil() {
+				fieldA = reflect.ValueOf(&ContainerExtensions{})
+			}
+			if fieldB.IsNil() {
+				fieldB = reflect.ValueOf(&ContainerExtensions{})
+			}
+			diffs = append(diffs, structDiff(prefix+field.Name+".", fieldA.Elem(), fieldB.Elem())...)
+			continue
+		}
+		if !reflect.DeepEqual(fieldA.Interface(), fieldB.Interface()) {
+			diffs = append(diffs, prefix+field.Name)
+		}
+	}
+	return diffs
+}
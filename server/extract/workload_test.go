@@ -0,0 +1,89 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/confidential-space/server/coscel"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-eventlog/cel"
+)
+
+func TestSameWorkload(t *testing.T) {
+	base := []coscel.COSTLV{
+		{EventType: coscel.ImageRefType, EventContent: []byte("docker.io/a@" + testImageDigest)},
+		{EventType: coscel.ImageDigestType, EventContent: []byte(testImageDigest)},
+		{EventType: coscel.ArgType, EventContent: []byte("--x")},
+		{EventType: coscel.EnvVarType, EventContent: []byte("ENV=prod")},
+		{EventType: coscel.MountType, EventContent: []byte("type=tmpfs,target=/tmp")},
+		{EventType: coscel.NonceType, EventContent: []byte("nonce-a")},
+		{EventType: coscel.LaunchSeparatorType},
+	}
+	withEvents := func(events ...coscel.COSTLV) []coscel.COSTLV {
+		return append(append([]coscel.COSTLV{}, base[:len(base)-1]...), append(events, base[len(base)-1])...)
+	}
+	testCases := []struct {
+		name      string
+		events    []coscel.COSTLV
+		wantSame  bool
+		wantDiffs []string
+	}{
+		{name: "identical", events: base, wantSame: true},
+		{
+			name: "different nonce",
+			events: func() []coscel.COSTLV {
+				events := append([]coscel.COSTLV{}, base...)
+				events[5] = coscel.COSTLV{EventType: coscel.NonceType, EventContent: []byte("nonce-b")}
+				return events
+			}(),
+			wantSame: true,
+		},
+		{
+			name:      "overridden env and extra mount",
+			events:    withEvents(coscel.COSTLV{EventType: coscel.OverrideEnvType, EventContent: []byte("ENV=dev")}, coscel.COSTLV{EventType: coscel.MountType, EventContent: []byte("type=bind,source=/a,target=/b")}),
+			wantDiffs: []string{"Container.OverriddenEnvVars", "ContainerExtensions.Mounts"},
+		},
+		{
+			name:     "restarted container",
+			events:   withEvents(coscel.COSTLV{EventType: coscel.RestartCountType, EventContent: []byte("3")}),
+			wantSame: true,
+		},
+		{
+			name:      "sealing policy",
+			events:    withEvents(coscel.COSTLV{EventType: coscel.SealingPolicyType, EventContent: []byte("policy")}),
+			wantDiffs: []string{"SealingPolicy"},
+		},
+		{
+			name: "different args",
+			events: func() []coscel.COSTLV {
+				events := append([]coscel.COSTLV{}, base...)
+				events[2] = coscel.COSTLV{EventType: coscel.ArgType, EventContent: []byte("--y")}
+				return events
+			}(),
+			wantDiffs: []string{"Container.Args"},
+		},
+	}
+	logA := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, base)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logB := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, tc.events)
+			same, diffs, err := SameWorkload(logA, logB, uint8(cel.CCMRType))
+			if err != nil {
+				t.Fatalf("SameWorkload() returned error: %v", err)
+			}
+			if same != tc.wantSame {
+				t.Errorf("SameWorkload() = %v, want %v", same, tc.wantSame)
+			}
+			if diff := cmp.Diff(tc.wantDiffs, diffs); diff != "" {
+				t.Errorf("SameWorkload() returned unexpected diffs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSameWorkloadInvalidLog(t *testing.T) {
+	logA := buildCEL(t, cel.CCMRType, coscel.COSCCELMRIndex, nil)
+	logB := buildCEL(t, cel.PCRType, coscel.EventPCRIndex, []coscel.COSTLV{{EventType: coscel.ImageRefType, EventContent: []byte("a")}})
+	if _, _, err := SameWorkload(logA, logB, uint8(cel.CCMRType)); err == nil {
+		t.Error("SameWorkload() with a log of the wrong register type returned nil error, want error")
+	}
+}